@@ -1,7 +1,9 @@
 package agent
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/yonidavidson/gopherconil.talk/prompt"
 	"github.com/yonidavidson/gopherconil.talk/provider"
@@ -10,28 +12,107 @@ import (
 
 // Agent represents a conversational agent that uses a language model and retrieval-augmented generation (RAG) to answer questions.
 type Agent struct {
-	p *provider.OpenAIProvider
-	r *rag.Rag
-	e []rag.Embedding
+	p          *provider.OpenAIProvider
+	r          *rag.Rag
+	e          []rag.Embedding
+	moderation ModerationMode
+	library    *prompt.Library
 }
 
+type (
+	// Option configures an Agent.
+	Option func(*Agent)
+
+	// ModerationMode controls what the agent does with flagged inputs and outputs.
+	ModerationMode int
+
+	// ModerationError is returned when the user query or the model output is flagged by moderation.
+	ModerationError struct {
+		// Stage is either "input" or "output".
+		Stage      string
+		Categories []string
+		Scores     map[string]float64
+	}
+)
+
+const (
+	// ModerationOff disables moderation.
+	ModerationOff ModerationMode = iota
+	// ModerationBlock stops handling the query as soon as the input or the output is flagged.
+	ModerationBlock
+	// ModerationAnnotate lets flagged content through and reports it alongside the response.
+	ModerationAnnotate
+)
+
 type promptData struct {
 	RAGContext   string
 	UserQuery    string
 	SystemPrompt string
 }
 
+func (e *ModerationError) Error() string {
+	return fmt.Sprintf("%s flagged by moderation: %s", e.Stage, strings.Join(e.Categories, ", "))
+}
+
+// WithModeration screens the user query and the model output using the provider moderation endpoint.
+func WithModeration(mode ModerationMode) Option {
+	return func(a *Agent) {
+		a.moderation = mode
+	}
+}
+
+// WithLibrary lets the agent handle queries with the prompts of a library, see HandlePrompt.
+func WithLibrary(l *prompt.Library) Option {
+	return func(a *Agent) {
+		a.library = l
+	}
+}
+
 // New creates a new instance of Agent with the provided OpenAI provider, RAG instance, and embeddings
-func New(p *provider.OpenAIProvider, r *rag.Rag, e []rag.Embedding) *Agent {
-	return &Agent{
+func New(p *provider.OpenAIProvider, r *rag.Rag, e []rag.Embedding, opts ...Option) *Agent {
+	a := &Agent{
 		p: p,
 		r: r,
 		e: e,
 	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
 }
 
 // HandleUserQuery takes a user query, retrieves relevant context using RAG, generates a prompt,
+// and returns the model completion.
+// With ModerationBlock a flagged query or completion returns a *ModerationError and no completion,
+// with ModerationAnnotate the completion is returned together with the *ModerationError,
+// joined with errors.Join when both the query and the completion are flagged.
 func (a Agent) HandleUserQuery(promptTemplate, systemPrompt, userQuery string) ([]byte, error) {
+	return a.handle(systemPrompt, userQuery, func(data promptData) ([]prompt.Message, error) {
+		m, _, err := prompt.ParseMessages(promptTemplate, data)
+		return m, err
+	})
+}
+
+// HandlePrompt is HandleUserQuery with a prompt of the agent library, an empty version selects the default one.
+func (a Agent) HandlePrompt(name, version, systemPrompt, userQuery string) ([]byte, error) {
+	if a.library == nil {
+		return nil, fmt.Errorf("no prompt library, see WithLibrary")
+	}
+	return a.handle(systemPrompt, userQuery, func(data promptData) ([]prompt.Message, error) {
+		m, _, err := a.library.Render(name, version, data)
+		return m, err
+	})
+}
+
+// handle runs a query through moderation, retrieval and the model, render builds the messages.
+func (a Agent) handle(systemPrompt, userQuery string, render func(promptData) ([]prompt.Message, error)) ([]byte, error) {
+	inputErr, err := a.moderate("input", userQuery)
+	if err != nil {
+		return nil, err
+	}
+	if inputErr != nil && a.moderation == ModerationBlock {
+		return nil, inputErr
+	}
 	var ragContext string
 	if a.r != nil && a.e != nil {
 		rc, err := a.r.Search(userQuery, a.e)
@@ -40,7 +121,7 @@ func (a Agent) HandleUserQuery(promptTemplate, systemPrompt, userQuery string) (
 		}
 		ragContext = string(rc)
 	}
-	m, _, err := prompt.ParseMessages(promptTemplate, promptData{
+	m, err := render(promptData{
 		RAGContext:   ragContext,
 		UserQuery:    userQuery,
 		SystemPrompt: systemPrompt,
@@ -52,5 +133,38 @@ func (a Agent) HandleUserQuery(promptTemplate, systemPrompt, userQuery string) (
 	if err != nil {
 		return nil, fmt.Errorf("error getting chat completion: %v", err)
 	}
-	return c, nil
+	outputErr, err := a.moderate("output", string(c))
+	if err != nil {
+		return nil, err
+	}
+	if outputErr != nil && a.moderation == ModerationBlock {
+		return nil, outputErr
+	}
+	// with ModerationAnnotate both stages can be flagged, report both
+	var errs []error
+	for _, me := range []*ModerationError{inputErr, outputErr} {
+		if me != nil {
+			errs = append(errs, me)
+		}
+	}
+	return c, errors.Join(errs...)
+}
+
+// moderate returns a *ModerationError if the text is flagged, the second error reports a failed moderation call.
+func (a Agent) moderate(stage, text string) (*ModerationError, error) {
+	if a.moderation == ModerationOff {
+		return nil, nil
+	}
+	rs, err := a.p.Moderate([]string{text})
+	if err != nil {
+		return nil, fmt.Errorf("error moderating %s: %v", stage, err)
+	}
+	if !rs[0].Flagged {
+		return nil, nil
+	}
+	return &ModerationError{
+		Stage:      stage,
+		Categories: rs[0].FlaggedCategories(),
+		Scores:     rs[0].CategoryScores,
+	}, nil
 }
@@ -0,0 +1,131 @@
+package agent_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/yonidavidson/gopherconil.talk/agent"
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+	"github.com/yonidavidson/gopherconil.talk/provider"
+)
+
+const template = `<system>{{.SystemPrompt}}</system><user>{{.UserQuery}}</user>`
+
+// newServer returns a stand-in OpenAI server that echoes the user query and flags any text containing "bad".
+func newServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chat/completions":
+			var req struct {
+				Messages []struct {
+					Content string `json:"content"`
+				} `json:"messages"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("invalid request: %v", err)
+			}
+			content, _ := json.Marshal("echo: " + req.Messages[len(req.Messages)-1].Content)
+			fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","content":%s}}]}`, content)
+		case "/moderations":
+			var req struct {
+				Input []string `json:"input"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("invalid request: %v", err)
+			}
+			flagged := strings.Contains(req.Input[0], "bad")
+			fmt.Fprintf(w, `{"results":[{"flagged":%t,"categories":{"harassment":%t,"violence":false},"category_scores":{"harassment":0.9,"violence":0.1}}]}`, flagged, flagged)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestHandleUserQueryModeration(t *testing.T) {
+	srv := newServer(t)
+	defer srv.Close()
+	p := &provider.OpenAIProvider{APIKey: "test-key", BaseURL: srv.URL}
+
+	tests := []struct {
+		name       string
+		mode       agent.ModerationMode
+		query      string
+		response   string
+		wantStages []string
+	}{
+		{name: "clean query", mode: agent.ModerationBlock, query: "hello", response: "echo: hello"},
+		{name: "blocked query", mode: agent.ModerationBlock, query: "bad words", wantStages: []string{"input"}},
+		// the echoed completion is flagged too
+		{name: "annotated query and output", mode: agent.ModerationAnnotate, query: "bad words", response: "echo: bad words", wantStages: []string{"input", "output"}},
+		{name: "moderation off", mode: agent.ModerationOff, query: "bad words", response: "echo: bad words"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := agent.New(p, nil, nil, agent.WithModeration(tt.mode))
+			c, err := a.HandleUserQuery(template, "be nice", tt.query)
+			if string(c) != tt.response {
+				t.Errorf("HandleUserQuery() = %q, want %q", c, tt.response)
+			}
+			if tt.wantStages == nil {
+				if err != nil {
+					t.Errorf("HandleUserQuery() error = %v", err)
+				}
+				return
+			}
+			var me *agent.ModerationError
+			if !errors.As(err, &me) {
+				t.Fatalf("expected a *ModerationError, got %v", err)
+			}
+			errs := []error{err}
+			if joined, ok := err.(interface{ Unwrap() []error }); ok {
+				errs = joined.Unwrap()
+			}
+			var stages []string
+			for _, err := range errs {
+				if !errors.As(err, &me) {
+					t.Fatalf("expected a *ModerationError, got %v", err)
+				}
+				if len(me.Categories) != 1 || me.Categories[0] != "harassment" {
+					t.Errorf("unexpected moderation error %+v", me)
+				}
+				stages = append(stages, me.Stage)
+			}
+			if strings.Join(stages, ",") != strings.Join(tt.wantStages, ",") {
+				t.Errorf("flagged stages = %v, want %v", stages, tt.wantStages)
+			}
+		})
+	}
+}
+
+func TestHandlePrompt(t *testing.T) {
+	srv := newServer(t)
+	defer srv.Close()
+	p := &provider.OpenAIProvider{APIKey: "test-key", BaseURL: srv.URL}
+	l, err := prompt.NewLibrary(fstest.MapFS{
+		"qa.tmpl":    {Data: []byte(template)},
+		"qa@v2.tmpl": {Data: []byte(`<system>{{.SystemPrompt}}</system><user>v2: {{.UserQuery}}</user>`)},
+	})
+	if err != nil {
+		t.Fatalf("NewLibrary() error = %v", err)
+	}
+
+	if _, err := agent.New(p, nil, nil).HandlePrompt("qa", "", "be nice", "hello"); err == nil {
+		t.Error("expected an error without a library")
+	}
+	a := agent.New(p, nil, nil, agent.WithLibrary(l))
+	for version, want := range map[string]string{"": "echo: hello", "v2": "echo: v2: hello"} {
+		c, err := a.HandlePrompt("qa", version, "be nice", "hello")
+		if err != nil {
+			t.Fatalf("HandlePrompt() error = %v", err)
+		}
+		if string(c) != want {
+			t.Errorf("HandlePrompt(%q) = %q, want %q", version, c, want)
+		}
+	}
+}
@@ -1,33 +1,21 @@
 package main
 
 import (
+	"embed"
 	"encoding/json"
 	"fmt"
+	"io/fs"
 
 	"github.com/yonidavidson/gopherconil.talk/agent"
+	"github.com/yonidavidson/gopherconil.talk/prompt"
 	"github.com/yonidavidson/gopherconil.talk/provider"
 	"github.com/yonidavidson/gopherconil.talk/rag"
 )
 
-const (
-	ragAgentTemplate = `<system>{{.SystemPrompt}}</system>
-<user>
-{{if .RAGContext}}Context: 
-{{.RAGContext}}{{end}}
-
-User Query: {{.UserQuery}}</user>`
-
-	structuredDataAgentTemplate = `<system>You are a API that returns a structured json based on content </system>
-<user>
-Based on this content:
-{{.UserQuery}} 
-return a list of questions to ask in a json as follows:
-{"questions": ["question1", "question2"]}
-each question should as for an insight on the content.
-make the questions rather short no more then 5 words.
-limit the number of questions to 3.
-</user>`
-)
+// prompts holds the agent templates, see prompt.Library.
+//
+//go:embed prompts
+var prompts embed.FS
 
 func main() {
 	p, err := provider.NewOpenAIProvider()
@@ -36,16 +24,27 @@ func main() {
 		return
 	}
 	r := rag.New(p)
-	es, err := r.Embed(txt, 1000)
+	// 200 tokens are about 1000 characters of this text
+	es, err := r.Embed(txt, 200)
 	if err != nil {
 		fmt.Printf("Error embedding text: %v\n", err)
 		return
 	}
-	ra := agent.New(p, r, es)
-	sa := agent.New(p, nil, nil)
+	sub, err := fs.Sub(prompts, "prompts")
+	if err != nil {
+		fmt.Printf("Error opening prompts: %v\n", err)
+		return
+	}
+	l, err := prompt.NewLibrary(sub)
+	if err != nil {
+		fmt.Printf("Error loading prompts: %v\n", err)
+		return
+	}
+	ra := agent.New(p, r, es, agent.WithLibrary(l))
+	sa := agent.New(p, nil, nil, agent.WithLibrary(l))
 
-	rac, err := ra.HandleUserQuery(
-		ragAgentTemplate,
+	rac, err := ra.HandlePrompt(
+		"rag", "",
 		"Answer the following question based only on the provided context:",
 		"What where the conclusions of the research?",
 	)
@@ -55,8 +54,8 @@ func main() {
 	}
 	printRagAgentResponse(rac)
 
-	sac, err := sa.HandleUserQuery(
-		structuredDataAgentTemplate,
+	sac, err := sa.HandlePrompt(
+		"questions", "",
 		"",
 		string(rac),
 	)
@@ -73,8 +72,8 @@ func main() {
 		return
 	}
 	for _, question := range questions.Questions {
-		crag, err := ra.HandleUserQuery(
-			ragAgentTemplate,
+		crag, err := ra.HandlePrompt(
+			"rag", "",
 			"Answer the following question based only on the provided context:",
 			question,
 		)
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+	"github.com/yonidavidson/gopherconil.talk/prompt/prompttest"
+)
+
+func TestPrompts(t *testing.T) {
+	sub, err := fs.Sub(prompts, "prompts")
+	if err != nil {
+		t.Fatalf("fs.Sub() error = %v", err)
+	}
+	l, err := prompt.NewLibrary(sub)
+	if err != nil {
+		t.Fatalf("NewLibrary() error = %v", err)
+	}
+	tests := []struct {
+		name   string
+		prompt string
+		data   map[string]string
+	}{
+		{
+			name:   "rag",
+			prompt: "rag",
+			data: map[string]string{
+				"SystemPrompt": "Answer the following question based only on the provided context:",
+				"RAGContext":   "The grouped model achieved a 10% improvement in detection success rate.",
+				"UserQuery":    "What where the conclusions of the research?",
+			},
+		},
+		{
+			name:   "rag_without_context",
+			prompt: "rag",
+			data: map[string]string{
+				"SystemPrompt": "Answer the following question based only on the provided context:",
+				"UserQuery":    "What where the conclusions of the research?",
+			},
+		},
+		{
+			name:   "questions",
+			prompt: "questions",
+			data:   map[string]string{"UserQuery": "The grouped model improved detection by 10%."},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, err := l.Render(tt.prompt, "", tt.data)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			prompttest.AssertGolden(t, tt.name, m)
+		})
+	}
+}
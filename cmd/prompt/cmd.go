@@ -8,44 +8,86 @@ import (
 )
 
 const promptTemplate = `<system>{{.SystemPrompt}}</system>
-{{.ChatHistory}}
+{{history .ChatHistory (.Budgets.Tokens "history")}}
 <user>
-Context: {{limitTokens .RAGContext (multiply .MaxTokens 0.2)}}
+Context: {{limitTokens .RAGContext (.Budgets.Tokens "context")}}
 User Query: {{.UserQuery}}</user>`
 
+const (
+	model          = "gpt-4o-mini-2024-07-18"
+	reservedOutput = 1000
+	// historyTokens is the size over which older turns are summarized
+	historyTokens = 2000
+	// systemTokens and queryTokens are the tokens kept for the system prompt and the user query,
+	// a section never gets more than its text needs
+	systemTokens = 500
+	queryTokens  = 500
+)
+
 type (
 	promptData struct {
-		MaxTokens    float64
+		Budgets      prompt.Budgets
 		RAGContext   string
 		UserQuery    string
-		ChatHistory  string
+		ChatHistory  *prompt.History
 		SystemPrompt string
 	}
 )
 
 func main() {
-	maxTokens := 200
+	tmpl, err := prompt.NewTemplate[promptData]("talk", promptTemplate)
+	if err != nil {
+		fmt.Printf("Error compiling template: %v\n", err)
+		return
+	}
 	ragContext := "Paris, the capital of France, is a major European city and a global center for art, fashion, gastronomy, and culture. Its 19th-century cityscape is crisscrossed by wide boulevards and the River Seine. Beyond such landmarks as the Eiffel Tower and the 12th-century, Gothic Notre-Dame cathedral, the city is known for its cafe culture and designer boutiques along the Rue du Faubourg Saint-Honoré."
 	userQuery := "Can you tell me about the history and main attractions of Paris? Also, what`s the best time to visit and are there any local customs I should be aware of?"
-	chatHistory := "<user>I`m planning a trip to Europe.</user>\n<assistant>That`s exciting! Europe has many wonderful destinations. Do you have any specific countries or cities in mind?</assistant>\n<user>I am thinking about visiting France.</user>\n<assistant>France is a great choice! It offers a rich history, beautiful landscapes, and world-renowned cuisine. Are you interested in visiting Paris or exploring other regions as well?</assistant>"
+	p, err := provider.NewOpenAIProvider()
+	if err != nil {
+		fmt.Printf("Error creating OpenAI provider: %v\n", err)
+		return
+	}
+	p.Model = model
+	chatHistory := prompt.NewHistory(historyTokens, p)
+	err = chatHistory.Append(
+		prompt.Message{Role: prompt.RoleUser, Content: "I`m planning a trip to Europe."},
+		prompt.Message{Role: prompt.RoleAssistant, Content: "That`s exciting! Europe has many wonderful destinations. Do you have any specific countries or cities in mind?"},
+		prompt.Message{Role: prompt.RoleUser, Content: "I am thinking about visiting France."},
+		prompt.Message{Role: prompt.RoleAssistant, Content: "France is a great choice! It offers a rich history, beautiful landscapes, and world-renowned cuisine. Are you interested in visiting Paris or exploring other regions as well?"},
+	)
+	if err != nil {
+		fmt.Printf("Error building chat history: %v\n", err)
+		return
+	}
 	systemPrompt := "You are a knowledgeable and helpful travel assistant. Provide accurate and concise information about destinations, attractions, local customs, and travel tips. When appropriate, suggest off-the-beaten-path experiences that tourists might not typically know about. Always prioritize the safety and cultural sensitivity of the traveler."
+	budget := prompt.NewBudget(provider.Capabilities(model).ContextWindow, reservedOutput,
+		// the template doesn't shorten the system prompt and the query, their minimums cover them
+		prompt.Section{Name: "system", Priority: 4, Min: systemTokens},
+		prompt.Section{Name: "query", Priority: 3, Min: queryTokens},
+		prompt.Section{Name: "history", Priority: 2, Ratio: 0.3},
+		prompt.Section{Name: "context", Priority: 1, Ratio: 0.7},
+	)
+	budgets, err := budget.Allocate(map[string]string{
+		"system":  systemPrompt,
+		"query":   userQuery,
+		"history": chatHistory.String(),
+	})
+	if err != nil {
+		fmt.Printf("Error allocating token budget: %v\n", err)
+		return
+	}
 	data := promptData{
-		MaxTokens:    float64(maxTokens),
+		Budgets:      budgets,
 		RAGContext:   ragContext,
 		UserQuery:    userQuery,
 		ChatHistory:  chatHistory,
 		SystemPrompt: systemPrompt,
 	}
-	m, _, err := prompt.ParseMessages(promptTemplate, data)
+	m, _, err := tmpl.Render(data)
 	if err != nil {
 		fmt.Printf("Error parsing messages: %v\n", err)
 		return
 	}
-	p, err := provider.NewOpenAIProvider()
-	if err != nil {
-		fmt.Printf("Error creating OpenAI provider: %v\n", err)
-		return
-	}
 	r, err := p.ChatCompletion(m)
 	if err != nil {
 		fmt.Printf("Error getting chat completion: %v\n", err)
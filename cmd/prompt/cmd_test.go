@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+	"github.com/yonidavidson/gopherconil.talk/prompt/prompttest"
+)
+
+func TestPromptTemplate(t *testing.T) {
+	tmpl, err := prompt.NewTemplate[promptData]("talk", promptTemplate)
+	if err != nil {
+		t.Fatalf("NewTemplate() error = %v", err)
+	}
+	history := prompt.NewHistory(0, nil)
+	err = history.Append(
+		prompt.Message{Role: prompt.RoleUser, Content: "I am planning a trip to Europe."},
+		prompt.Message{Role: prompt.RoleAssistant, Content: "Do you have any specific countries in mind?"},
+	)
+	if err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	tests := []struct {
+		name string
+		data promptData
+	}{
+		{
+			name: "talk",
+			data: promptData{
+				Budgets:      prompt.Budgets{"history": 1000, "context": 1000},
+				RAGContext:   "Paris is the capital of France.",
+				UserQuery:    "What should I see in Paris?",
+				ChatHistory:  history,
+				SystemPrompt: "You are a helpful travel assistant.",
+			},
+		},
+		{
+			name: "talk_truncated",
+			data: promptData{
+				Budgets:      prompt.Budgets{"history": 15, "context": 5},
+				RAGContext:   "Paris is the capital of France. It is known for the Eiffel Tower, the Louvre and its cafes.",
+				UserQuery:    "What should I see in Paris?",
+				ChatHistory:  history,
+				SystemPrompt: "You are a helpful travel assistant.",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, err := tmpl.Render(tt.data)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			prompttest.AssertGolden(t, tt.name, m)
+		})
+	}
+}
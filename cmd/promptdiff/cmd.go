@@ -0,0 +1,141 @@
+// Command promptdiff renders two versions of a prompt template with the same fixture data
+// and prints how their messages changed, with token counts, for code review.
+//
+//	promptdiff [-data fixtures.json] old.prompt new.prompt
+//	promptdiff [-data fixtures.json] -base main prompts/rag.tmpl...
+//
+// With -base the old version of every file is read from a git revision.
+// The fixture file holds one data object or an array of them, each is rendered and compared.
+// It exits with status 1 when the messages differ.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+)
+
+// version is the source of one version of a prompt file.
+type version struct {
+	label string
+	src   []byte
+}
+
+func main() {
+	dataPath := flag.String("data", "", "JSON fixture, or array of fixtures, to render the templates with")
+	base := flag.String("base", "", "git revision of the old version of the files")
+	flag.Parse()
+	var pairs [][2]version
+	switch {
+	case *base != "" && flag.NArg() > 0:
+		for _, path := range flag.Args() {
+			before, err := gitShow(*base, path)
+			if err != nil {
+				fail(err)
+			}
+			after, err := os.ReadFile(path)
+			if err != nil {
+				fail(err)
+			}
+			pairs = append(pairs, [2]version{{*base + ":" + path, before}, {path, after}})
+		}
+	case *base == "" && flag.NArg() == 2:
+		var p [2]version
+		for i, path := range flag.Args() {
+			src, err := os.ReadFile(path)
+			if err != nil {
+				fail(err)
+			}
+			p[i] = version{path, src}
+		}
+		pairs = append(pairs, p)
+	default:
+		fmt.Fprintln(os.Stderr, "usage: promptdiff [-data fixtures.json] old new\n       promptdiff [-data fixtures.json] -base rev path...")
+		os.Exit(2)
+	}
+	fixtures, err := loadFixtures(*dataPath)
+	if err != nil {
+		fail(err)
+	}
+	changed, err := diff(os.Stdout, pairs, fixtures)
+	if err != nil {
+		fail(err)
+	}
+	if changed {
+		os.Exit(1)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	os.Exit(2)
+}
+
+// diff writes the diff of every pair of versions for every fixture, and reports whether any differs.
+func diff(w io.Writer, pairs [][2]version, fixtures []any) (bool, error) {
+	changed := false
+	for _, p := range pairs {
+		before, err := prompt.ParseFile(p[0].label, p[0].src)
+		if err != nil {
+			return false, err
+		}
+		after, err := prompt.ParseFile(p[1].label, p[1].src)
+		if err != nil {
+			return false, err
+		}
+		for i, data := range fixtures {
+			d, err := prompt.DiffFiles(before, after, data)
+			if err != nil {
+				return false, fmt.Errorf("fixture %d of %s: %v", i+1, p[1].label, err)
+			}
+			fmt.Fprintf(w, "### %s → %s", p[0].label, p[1].label)
+			if len(fixtures) > 1 {
+				fmt.Fprintf(w, ", fixture %d", i+1)
+			}
+			fmt.Fprintf(w, "\n%s\n", d)
+			changed = changed || !d.Equal()
+		}
+	}
+	return changed, nil
+}
+
+// loadFixtures reads a JSON object or array of objects, without a path the templates are rendered without data.
+func loadFixtures(path string) ([]any, error) {
+	if path == "" {
+		return []any{nil}, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading fixtures: %v", err)
+	}
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("error decoding fixtures: %v", err)
+	}
+	if list, ok := v.([]any); ok {
+		return list, nil
+	}
+	return []any{v}, nil
+}
+
+// gitShow reads a file at a git revision.
+func gitShow(rev, path string) ([]byte, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("git", "show", rev+":./"+filepath.Base(abs))
+	cmd.Dir = filepath.Dir(abs)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s at %s: %v", path, rev, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	pairs := [][2]version{{
+		{"old.prompt", []byte("<system>Answer.</system>\n<user>{{.Query}}</user>")},
+		{"new.prompt", []byte("<system>Answer and cite sources.</system>\n<user>{{.Query}}</user>")},
+	}}
+	var out strings.Builder
+	changed, err := diff(&out, pairs, []any{map[string]any{"Query": "Why?"}, map[string]any{"Query": "How?"}})
+	if err != nil {
+		t.Fatalf("error diffing: %v", err)
+	}
+	if !changed {
+		t.Errorf("expected a change")
+	}
+	for _, want := range []string{"### old.prompt → new.prompt, fixture 1\n", "### old.prompt → new.prompt, fixture 2\n", "- Answer.\n+ Answer and cite sources.\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output doesn't contain %q:\n%s", want, out.String())
+		}
+	}
+	if _, err := diff(&out, pairs, []any{map[string]any{}}); err == nil {
+		t.Errorf("expected an error for a fixture missing variables")
+	}
+}
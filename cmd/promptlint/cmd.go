@@ -0,0 +1,87 @@
+// Command promptlint checks prompt templates and prints one problem per line as file:line:col: rule: message.
+// It exits with status 1 when it finds problems, which fails a CI step.
+//
+//	promptlint [-data fixture.json] [-model gpt-4o] path...
+//
+// Paths are .prompt and .tmpl files, or directories searched for them.
+// With -data the templates are rendered with the fixture to check the data and the size of the prompt,
+// the fixture can be shared by several templates, keys a template doesn't use aren't problems.
+// Variables are checked against the required and optional lists of the front matter, templates without them,
+// such as .tmpl files, only get their variables checked by rendering the fixture.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+	"github.com/yonidavidson/gopherconil.talk/provider"
+)
+
+func main() {
+	dataPath := flag.String("data", "", "JSON fixture to render the templates with")
+	model := flag.String("model", "gpt-4o-mini", "model of the templates whose front matter doesn't set one")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: promptlint [-data fixture.json] [-model name] path...")
+		os.Exit(2)
+	}
+	opts := prompt.LintOptions{
+		Model: *model,
+		ContextWindow: func(model string) int {
+			return provider.Capabilities(model).ContextWindow
+		},
+	}
+	if *dataPath != "" {
+		b, err := os.ReadFile(*dataPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading fixture: %v\n", err)
+			os.Exit(2)
+		}
+		if err := json.Unmarshal(b, &opts.Data); err != nil {
+			fmt.Fprintf(os.Stderr, "Error decoding fixture: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	n, err := lint(os.Stdout, flag.Args(), opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if n > 0 {
+		os.Exit(1)
+	}
+}
+
+// lint writes the problems of the templates under paths to w and returns how many it found.
+func lint(w io.Writer, paths []string, opts prompt.LintOptions) (int, error) {
+	n := 0
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if ext := filepath.Ext(path); d.IsDir() || path != root && ext != ".prompt" && ext != ".tmpl" {
+				return nil
+			}
+			src, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			for _, d := range prompt.Lint(path, src, opts) {
+				fmt.Fprintln(w, d)
+				n++
+			}
+			return nil
+		})
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
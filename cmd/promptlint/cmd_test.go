@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+)
+
+func TestLint(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"ok.tmpl":      "<system>Be brief.</system>\n<user>{{.Query}}</user>\n",
+		"bad.prompt":   "<user>Hi</user>\n<user>{{.Query}}</user>\n",
+		"notes.txt":    "<user>not a template",
+		"sub/x.prompt": "<assistant></assistant>\n",
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var out strings.Builder
+	n, err := lint(&out, []string{dir}, prompt.LintOptions{})
+	if err != nil {
+		t.Fatalf("error linting: %v", err)
+	}
+	want := filepath.Join(dir, "bad.prompt") + ":2:1: repeated-role: <user> follows the <user> message at 1:1, merge them or add the other role between\n" +
+		filepath.Join(dir, "sub", "x.prompt") + ":1:1: empty-message: <assistant> message is empty\n"
+	if n != 2 || out.String() != want {
+		t.Errorf("lint() = %d, %q, want 2, %q", n, out.String(), want)
+	}
+}
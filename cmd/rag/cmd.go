@@ -25,13 +25,19 @@ type (
 )
 
 func main() {
+	tmpl, err := prompt.NewTemplate[promptData]("rag", promptTemplate)
+	if err != nil {
+		fmt.Printf("Error compiling template: %v\n", err)
+		return
+	}
 	p, err := provider.NewOpenAIProvider()
 	if err != nil {
 		fmt.Printf("Error creating provider: %v\n", err)
 		return
 	}
 	r := rag.New(p)
-	es, err := r.Embed(txt, 1000)
+	// 200 tokens are about 1000 characters of this text
+	es, err := r.Embed(txt, 200)
 	if err != nil {
 		fmt.Printf("Error embedding text: %v\n", err)
 		return
@@ -44,7 +50,7 @@ func main() {
 		return
 	}
 	fmt.Println("RAG CONTEXT:\n " + string(ragContext))
-	m, _, err := prompt.ParseMessages(promptTemplate, promptData{
+	m, _, err := tmpl.Render(promptData{
 		MaxTokens:    1000,
 		RAGContext:   string(ragContext),
 		UserQuery:    userQuery,
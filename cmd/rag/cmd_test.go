@@ -0,0 +1,15 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt/prompttest"
+)
+
+func TestPromptTemplate(t *testing.T) {
+	prompttest.AssertTemplate(t, "rag", promptTemplate, promptData{
+		RAGContext:   "The grouped model achieved a 10% improvement in detection success rate.",
+		UserQuery:    "What where the conclusions of the research?",
+		SystemPrompt: "Answer the following question based only on the provided context:",
+	})
+}
@@ -0,0 +1,215 @@
+// Package experiment runs A/B tests between variants of a prompt template and records their results as JSONL.
+package experiment
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	mathrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+	"github.com/yonidavidson/gopherconil.talk/provider"
+)
+
+type (
+	// Completer sends messages to a model, *provider.OpenAIProvider is one.
+	Completer interface {
+		ChatCompletionWithUsage(m []prompt.Message) ([]byte, provider.Usage, error)
+	}
+
+	// Variant is one version of the prompt, requests are assigned to variants in proportion to their weights.
+	Variant struct {
+		Name     string
+		Weight   float64
+		Template string
+	}
+
+	// Experiment assigns requests to variants, runs them and writes a Record for every answer and every feedback.
+	Experiment struct {
+		name     string
+		c        Completer
+		variants []Variant
+		tmpls    []*prompt.Template[any]
+		total    float64
+
+		mu    sync.Mutex
+		rand  *mathrand.Rand
+		w     io.Writer
+		stats *aggregator
+	}
+
+	// Option configures an Experiment.
+	Option func(*Experiment)
+
+	// Record is a line of the results file, either a "result" or a "feedback" on a result.
+	Record struct {
+		Type       string    `json:"type"`
+		ID         string    `json:"id"`
+		Experiment string    `json:"experiment"`
+		Variant    string    `json:"variant,omitempty"`
+		Key        string    `json:"key,omitempty"`
+		Time       time.Time `json:"time"`
+		// LatencyMS is the duration of the model call, the metrics are always written since 0 is a value
+		LatencyMS        int64   `json:"latency_ms"`
+		PromptTokens     int     `json:"prompt_tokens"`
+		CompletionTokens int     `json:"completion_tokens"`
+		Error            string  `json:"error,omitempty"`
+		Score            float64 `json:"score"`
+		Comment          string  `json:"comment,omitempty"`
+	}
+)
+
+const (
+	recordResult   = "result"
+	recordFeedback = "feedback"
+)
+
+// WithSeed makes the assignment of requests without a key reproducible.
+func WithSeed(seed int64) Option {
+	return func(e *Experiment) {
+		e.rand = mathrand.New(mathrand.NewSource(seed))
+	}
+}
+
+// New compiles the variants of an experiment, records are written to w as JSONL.
+func New(name string, c Completer, w io.Writer, variants []Variant, opts ...Option) (*Experiment, error) {
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("experiment %s has no variants", name)
+	}
+	e := &Experiment{
+		name:     name,
+		c:        c,
+		variants: variants,
+		rand:     mathrand.New(mathrand.NewSource(time.Now().UnixNano())),
+		w:        w,
+		stats:    newAggregator(),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	seen := map[string]bool{}
+	for _, v := range variants {
+		if v.Weight < 0 || seen[v.Name] {
+			return nil, fmt.Errorf("variant %q must have a unique name and a non-negative weight", v.Name)
+		}
+		seen[v.Name] = true
+		t, err := prompt.NewTemplate[any](v.Name, v.Template)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling variant %s: %v", v.Name, err)
+		}
+		e.tmpls = append(e.tmpls, t)
+		e.total += v.Weight
+		e.stats.add(v.Name)
+	}
+	if e.total == 0 {
+		return nil, fmt.Errorf("experiment %s has no variant with a positive weight", name)
+	}
+	return e, nil
+}
+
+// Assign returns the variant of a request. Requests with the same non-empty key, such as a user ID,
+// always get the same variant, the others are assigned at random.
+func (e *Experiment) Assign(key string) Variant {
+	return e.variants[e.assign(key)]
+}
+
+func (e *Experiment) assign(key string) int {
+	var x float64
+	if key == "" {
+		e.mu.Lock()
+		x = e.rand.Float64()
+		e.mu.Unlock()
+	} else {
+		h := fnv.New64a()
+		h.Write([]byte(e.name + "\x00" + key))
+		x = float64(h.Sum64()>>11) / (1 << 53)
+	}
+	x *= e.total
+	for i, v := range e.variants {
+		if x < v.Weight {
+			return i
+		}
+		x -= v.Weight
+	}
+	// rounding, the last variant with a weight
+	for i := len(e.variants) - 1; ; i-- {
+		if e.variants[i].Weight > 0 {
+			return i
+		}
+	}
+}
+
+// Run renders the variant assigned to key with data, sends it to the model and records the result.
+// The returned record identifies the answer for Feedback.
+func (e *Experiment) Run(key string, data any) (Record, []byte, error) {
+	i := e.assign(key)
+	r := Record{
+		Type:       recordResult,
+		ID:         newID(),
+		Experiment: e.name,
+		Variant:    e.variants[i].Name,
+		Key:        key,
+		Time:       time.Now().UTC(),
+	}
+	m, _, err := e.tmpls[i].Render(data)
+	if err != nil {
+		// a template that can't render the data is a bug, not a result of the variant
+		return r, nil, fmt.Errorf("error rendering variant %s: %v", r.Variant, err)
+	}
+	start := time.Now()
+	c, usage, err := e.c.ChatCompletionWithUsage(m)
+	r.LatencyMS = time.Since(start).Milliseconds()
+	r.PromptTokens = usage.PromptTokens
+	r.CompletionTokens = usage.CompletionTokens
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if werr := e.write(r); werr != nil {
+		return r, c, werr
+	}
+	return r, c, err
+}
+
+// Feedback records a user score for the answer with the given record ID, such as 1 for a thumbs up and 0 for a thumbs down.
+func (e *Experiment) Feedback(id string, score float64, comment string) error {
+	return e.write(Record{
+		Type:       recordFeedback,
+		ID:         id,
+		Experiment: e.name,
+		Time:       time.Now().UTC(),
+		Score:      score,
+		Comment:    comment,
+	})
+}
+
+// Summary returns the summary of every variant since the experiment was created, in the order of the variants.
+func (e *Experiment) Summary() []Summary {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stats.summaries()
+}
+
+func (e *Experiment) write(r Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.stats.record(r)
+	if _, err := e.w.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("error writing record: %v", err)
+	}
+	return nil
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
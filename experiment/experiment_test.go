@@ -0,0 +1,165 @@
+package experiment_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/yonidavidson/gopherconil.talk/experiment"
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+	"github.com/yonidavidson/gopherconil.talk/provider"
+)
+
+type fakeCompleter struct {
+	fail bool
+}
+
+func (f fakeCompleter) ChatCompletionWithUsage(m []prompt.Message) ([]byte, provider.Usage, error) {
+	if f.fail {
+		return nil, provider.Usage{}, errors.New("model unavailable")
+	}
+	return []byte("answer to " + m[len(m)-1].Content), provider.Usage{PromptTokens: 10, CompletionTokens: 5}, nil
+}
+
+var variants = []experiment.Variant{
+	{Name: "short", Weight: 1, Template: "<user>{{.Query}}</user>"},
+	{Name: "polite", Weight: 3, Template: "<system>Be polite.</system><user>{{.Query}}</user>"},
+}
+
+func TestAssign(t *testing.T) {
+	e, err := experiment.New("wording", fakeCompleter{}, &bytes.Buffer{}, variants, experiment.WithSeed(1))
+	if err != nil {
+		t.Fatalf("error creating experiment: %v", err)
+	}
+	for _, key := range []string{"alice", "bob", "carol"} {
+		want := e.Assign(key).Name
+		for i := 0; i < 10; i++ {
+			if got := e.Assign(key).Name; got != want {
+				t.Errorf("Assign(%q) = %s, want the sticky variant %s", key, got, want)
+			}
+		}
+	}
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		counts[e.Assign("").Name]++
+	}
+	if counts["polite"] < 2700 || counts["polite"] > 3300 {
+		t.Errorf("polite was assigned %d of 4000 requests, want about 3000", counts["polite"])
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		variants []experiment.Variant
+	}{
+		{name: "no variants"},
+		{name: "zero weights", variants: []experiment.Variant{{Name: "a", Template: "<user>hi</user>"}}},
+		{name: "negative weight", variants: []experiment.Variant{{Name: "a", Weight: -1, Template: "<user>hi</user>"}}},
+		{name: "duplicate names", variants: []experiment.Variant{{Name: "a", Weight: 1}, {Name: "a", Weight: 1}}},
+		{name: "invalid template", variants: []experiment.Variant{{Name: "a", Weight: 1, Template: "{{.Query"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := experiment.New("wording", fakeCompleter{}, &bytes.Buffer{}, tt.variants); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestRunAndSummarize(t *testing.T) {
+	var out bytes.Buffer
+	e, err := experiment.New("wording", fakeCompleter{}, &out, variants)
+	if err != nil {
+		t.Fatalf("error creating experiment: %v", err)
+	}
+	data := map[string]any{"Query": "What is Go?"}
+	for _, key := range []string{"alice", "bob", "carol", "dave"} {
+		r, answer, err := e.Run(key, data)
+		if err != nil {
+			t.Fatalf("error running %s: %v", key, err)
+		}
+		if string(answer) != "answer to What is Go?" {
+			t.Errorf("unexpected answer %q", answer)
+		}
+		if r.Variant != e.Assign(key).Name || r.PromptTokens != 10 || r.CompletionTokens != 5 {
+			t.Errorf("unexpected record %+v", r)
+		}
+		if err := e.Feedback(r.ID, 1, ""); err != nil {
+			t.Fatalf("error recording feedback: %v", err)
+		}
+	}
+	if _, _, err := e.Run("alice", map[string]any{}); err == nil {
+		t.Errorf("expected an error for missing template data")
+	}
+	if lines := strings.Count(out.String(), "\n"); lines != 8 {
+		t.Errorf("got %d records, want 8", lines)
+	}
+
+	live := e.Summary()
+	offline, err := experiment.Summarize(strings.NewReader("\n"+out.String()+`{"type":"result","id":"x","experiment":"other","variant":"other"}`+"\n"), "wording")
+	if err != nil {
+		t.Fatalf("error summarizing: %v", err)
+	}
+	requests, feedback := 0, 0
+	for _, s := range live {
+		requests += s.Requests
+		feedback += s.Feedback
+		if s.Requests > 0 && (s.MeanPromptTokens != 10 || s.MeanCompletionTokens != 5 || s.MeanScore != 1) {
+			t.Errorf("unexpected summary %v", s)
+		}
+	}
+	if requests != 4 || feedback != 4 {
+		t.Errorf("got %d requests and %d feedback, want 4 and 4", requests, feedback)
+	}
+	for _, s := range offline {
+		var l experiment.Summary
+		for _, ls := range live {
+			if ls.Variant == s.Variant {
+				l = ls
+			}
+		}
+		if s.Variant != l.Variant || s.Requests != l.Requests || s.Feedback != l.Feedback || s.MeanScore != l.MeanScore {
+			t.Errorf("offline summary %v doesn't match live summary %v", s, l)
+		}
+	}
+}
+
+func TestRunError(t *testing.T) {
+	var out bytes.Buffer
+	e, err := experiment.New("wording", fakeCompleter{fail: true}, &out, variants)
+	if err != nil {
+		t.Fatalf("error creating experiment: %v", err)
+	}
+	r, _, err := e.Run("alice", map[string]any{"Query": "hi"})
+	if err == nil || r.Error != "model unavailable" {
+		t.Errorf("expected the model error to be returned and recorded, got %v and %+v", err, r)
+	}
+	summaries, err := experiment.Summarize(&out, "")
+	if err != nil {
+		t.Fatalf("error summarizing: %v", err)
+	}
+	if len(summaries) != 1 || summaries[0].Errors != 1 || summaries[0].MeanLatency != 0 {
+		t.Errorf("unexpected summaries %v", summaries)
+	}
+	if _, err := experiment.Summarize(strings.NewReader("not json\n"), ""); err == nil {
+		t.Errorf("expected an error for a malformed record")
+	}
+}
+
+func TestFeedbackZeroScore(t *testing.T) {
+	var out bytes.Buffer
+	e, err := experiment.New("wording", fakeCompleter{}, &out, variants)
+	if err != nil {
+		t.Fatalf("error creating experiment: %v", err)
+	}
+	// a thumbs down is a score of 0, it must be in the record
+	if err := e.Feedback("x", 0, ""); err != nil {
+		t.Fatalf("error recording feedback: %v", err)
+	}
+	if !strings.Contains(out.String(), `"score":0`) {
+		t.Errorf("feedback record %s has no score", out.String())
+	}
+}
@@ -0,0 +1,123 @@
+package experiment
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+type (
+	// Summary aggregates the records of a variant.
+	Summary struct {
+		Variant  string
+		Requests int
+		Errors   int
+		// MeanLatency, MeanPromptTokens and MeanCompletionTokens are averaged over the requests without errors
+		MeanLatency          time.Duration
+		MeanPromptTokens     float64
+		MeanCompletionTokens float64
+		Feedback             int
+		MeanScore            float64
+
+		latency          time.Duration
+		promptTokens     int
+		completionTokens int
+		score            float64
+	}
+
+	// aggregator builds summaries from records, feedback is matched to results by ID.
+	aggregator struct {
+		order     []string
+		byVariant map[string]*Summary
+		variantOf map[string]string
+	}
+)
+
+// Summarize reads a results file and returns the summary of every variant, in the order they first appear.
+// Records of other experiments are skipped when experiment isn't empty.
+func Summarize(r io.Reader, experiment string) ([]Summary, error) {
+	a := newAggregator()
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("error decoding record on line %d: %v", line, err)
+		}
+		if experiment != "" && rec.Experiment != experiment {
+			continue
+		}
+		if rec.Type == recordResult {
+			a.add(rec.Variant)
+		}
+		a.record(rec)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return a.summaries(), nil
+}
+
+func newAggregator() *aggregator {
+	return &aggregator{byVariant: map[string]*Summary{}, variantOf: map[string]string{}}
+}
+
+func (a *aggregator) add(variant string) {
+	if _, ok := a.byVariant[variant]; !ok {
+		a.order = append(a.order, variant)
+		a.byVariant[variant] = &Summary{Variant: variant}
+	}
+}
+
+func (a *aggregator) record(r Record) {
+	switch r.Type {
+	case recordResult:
+		s := a.byVariant[r.Variant]
+		if s == nil {
+			return
+		}
+		a.variantOf[r.ID] = r.Variant
+		s.Requests++
+		if r.Error != "" {
+			s.Errors++
+			return
+		}
+		s.latency += time.Duration(r.LatencyMS) * time.Millisecond
+		s.promptTokens += r.PromptTokens
+		s.completionTokens += r.CompletionTokens
+	case recordFeedback:
+		s := a.byVariant[a.variantOf[r.ID]]
+		if s == nil {
+			return
+		}
+		s.Feedback++
+		s.score += r.Score
+	}
+}
+
+func (a *aggregator) summaries() []Summary {
+	result := make([]Summary, len(a.order))
+	for i, name := range a.order {
+		s := *a.byVariant[name]
+		if ok := s.Requests - s.Errors; ok > 0 {
+			s.MeanLatency = s.latency / time.Duration(ok)
+			s.MeanPromptTokens = float64(s.promptTokens) / float64(ok)
+			s.MeanCompletionTokens = float64(s.completionTokens) / float64(ok)
+		}
+		if s.Feedback > 0 {
+			s.MeanScore = s.score / float64(s.Feedback)
+		}
+		result[i] = s
+	}
+	return result
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("%s: %d requests, %d errors, %v mean latency, %.1f prompt and %.1f completion tokens, %d feedback, %.2f mean score",
+		s.Variant, s.Requests, s.Errors, s.MeanLatency, s.MeanPromptTokens, s.MeanCompletionTokens, s.Feedback, s.MeanScore)
+}
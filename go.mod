@@ -1,3 +1,5 @@
 module github.com/yonidavidson/gopherconil.talk
 
 go 1.21.0
+
+require gopkg.in/yaml.v3 v3.0.1
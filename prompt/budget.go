@@ -0,0 +1,120 @@
+package prompt
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/yonidavidson/gopherconil.talk/tokenizer"
+)
+
+type (
+	// Section is a named part of a prompt, such as the system prompt, chat history, RAG context or user query.
+	Section struct {
+		Name string
+		// Priority orders sections when tokens are scarce, higher priorities get their minimum and any surplus first.
+		Priority int
+		// Ratio is the share of the available tokens the section gets, relative to the other sections.
+		Ratio float64
+		// Min is the number of tokens the section gets before ratios are applied.
+		Min int
+		// Max caps the tokens of the section, zero means no cap.
+		Max int
+	}
+
+	// Budget splits the context window of a model, minus the tokens reserved for the output, across sections.
+	Budget struct {
+		ContextWindow  int
+		ReservedOutput int
+		Sections       []Section
+	}
+
+	// Budgets holds the tokens allocated to each section, templates read them with {{.Budgets.Tokens "context"}}.
+	Budgets map[string]int
+)
+
+// NewBudget creates a Budget for a model context window.
+func NewBudget(contextWindow, reservedOutput int, sections ...Section) Budget {
+	return Budget{
+		ContextWindow:  contextWindow,
+		ReservedOutput: reservedOutput,
+		Sections:       sections,
+	}
+}
+
+// Tokens returns the tokens allocated to a section, as a float64 so it can be passed to limitTokens.
+func (b Budgets) Tokens(name string) float64 {
+	return float64(b[name])
+}
+
+// Allocate splits the available tokens across the sections.
+// content holds the text of the sections that are already known, a section never gets more tokens than its
+// content needs and what it leaves is handed to the other sections by priority. Sections missing from content
+// take as many tokens as they are given.
+// Sections with known content and no ratio, such as the system prompt or the query, aren't shortened by the template,
+// so they get all of their tokens by priority before the ratios are applied, and Allocate fails when they don't fit.
+func (b Budget) Allocate(content map[string]string) (Budgets, error) {
+	available := b.ContextWindow - b.ReservedOutput
+	if available <= 0 {
+		return nil, fmt.Errorf("reserved output of %d tokens leaves nothing of a %d token context window", b.ReservedOutput, b.ContextWindow)
+	}
+	sections := append([]Section(nil), b.Sections...)
+	sort.SliceStable(sections, func(i, j int) bool { return sections[i].Priority > sections[j].Priority })
+
+	enc := tokenizer.Default()
+	need := make(map[string]int, len(sections))
+	var ratios float64
+	for _, s := range sections {
+		if s.Ratio < 0 || s.Min < 0 || s.Max < 0 {
+			return nil, fmt.Errorf("section %s has a negative ratio, min or max", s.Name)
+		}
+		n := math.MaxInt
+		if text, ok := content[s.Name]; ok {
+			n = enc.Count(text)
+		}
+		if s.Max > 0 && s.Max < n {
+			n = s.Max
+		}
+		need[s.Name] = n
+		ratios += s.Ratio
+	}
+
+	budgets := make(Budgets, len(sections))
+	give := func(name string, tokens int) {
+		if left := need[name] - budgets[name]; tokens > left {
+			tokens = left
+		}
+		if tokens > available {
+			tokens = available
+		}
+		budgets[name] += tokens
+		available -= tokens
+	}
+
+	// minimums first, by priority
+	for _, s := range sections {
+		give(s.Name, s.Min)
+	}
+	// then the sections that need all of their content, by priority
+	for _, s := range sections {
+		if _, ok := content[s.Name]; !ok || s.Ratio > 0 {
+			continue
+		}
+		give(s.Name, need[s.Name])
+		if budgets[s.Name] < need[s.Name] {
+			return nil, fmt.Errorf("section %s needs %d tokens, only %d are left", s.Name, need[s.Name], budgets[s.Name])
+		}
+	}
+	// then the ratios over what is left
+	if ratios > 0 {
+		rest := available
+		for _, s := range sections {
+			give(s.Name, int(float64(rest)*s.Ratio/ratios))
+		}
+	}
+	// and finally the surplus of sections that needed less than their share, by priority
+	for _, s := range sections {
+		give(s.Name, available)
+	}
+	return budgets, nil
+}
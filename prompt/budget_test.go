@@ -0,0 +1,108 @@
+package prompt_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+	"github.com/yonidavidson/gopherconil.talk/tokenizer"
+)
+
+func TestBudgetAllocate(t *testing.T) {
+	enc := tokenizer.Default()
+	query := "What is the capital of France?"
+	queryTokens := enc.Count(query)
+
+	tests := []struct {
+		name     string
+		budget   prompt.Budget
+		content  map[string]string
+		expected prompt.Budgets
+	}{
+		{
+			name: "ratios without content",
+			budget: prompt.NewBudget(1100, 100,
+				prompt.Section{Name: "history", Ratio: 0.3},
+				prompt.Section{Name: "context", Ratio: 0.7},
+			),
+			expected: prompt.Budgets{"history": 300, "context": 700},
+		},
+		{
+			name: "short content leaves its surplus to higher priorities",
+			budget: prompt.NewBudget(1100, 100,
+				prompt.Section{Name: "query", Priority: 3, Ratio: 0.5},
+				prompt.Section{Name: "context", Priority: 2, Ratio: 0.25},
+				prompt.Section{Name: "history", Priority: 1, Ratio: 0.25},
+			),
+			content:  map[string]string{"query": query},
+			expected: prompt.Budgets{"query": queryTokens, "context": 1000 - queryTokens - 250, "history": 250},
+		},
+		{
+			name: "minimums by priority when tokens are scarce",
+			budget: prompt.NewBudget(200, 100,
+				prompt.Section{Name: "system", Priority: 2, Min: 80},
+				prompt.Section{Name: "context", Priority: 1, Min: 80, Ratio: 1},
+			),
+			expected: prompt.Budgets{"system": 80, "context": 20},
+		},
+		{
+			name: "known content without a ratio before the ratios",
+			budget: prompt.NewBudget(1000, 200,
+				prompt.Section{Name: "system", Priority: 4},
+				prompt.Section{Name: "query", Priority: 3},
+				prompt.Section{Name: "history", Priority: 2, Ratio: 0.3},
+				prompt.Section{Name: "context", Priority: 1, Ratio: 0.7},
+			),
+			content:  map[string]string{"system": strings.Repeat(" a", 300), "query": strings.Repeat(" b", 100)},
+			expected: prompt.Budgets{"system": 300, "query": 100, "history": 120, "context": 280},
+		},
+		{
+			name: "max caps a section",
+			budget: prompt.NewBudget(1000, 0,
+				prompt.Section{Name: "history", Priority: 2, Ratio: 1, Max: 100},
+				prompt.Section{Name: "context", Priority: 1, Ratio: 1},
+			),
+			expected: prompt.Budgets{"history": 100, "context": 900},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.budget.Allocate(tt.content)
+			if err != nil {
+				t.Fatalf("Allocate() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Allocate() = %v, want %v", got, tt.expected)
+			}
+		})
+	}	// the query isn't shortened by the template, so it must fit whole
+	_, err := prompt.NewBudget(300, 200,
+		prompt.Section{Name: "system", Priority: 2},
+		prompt.Section{Name: "query", Priority: 1},
+	).Allocate(map[string]string{"system": strings.Repeat(" a", 60), "query": strings.Repeat(" b", 60)})
+	if err == nil {
+		t.Error("expected an error when the query doesn't fit")
+	}
+}
+
+func TestBudgetTemplate(t *testing.T) {
+	budgets, err := prompt.NewBudget(150, 100, prompt.Section{Name: "context", Ratio: 1}).Allocate(nil)
+	if err != nil {
+		t.Fatalf("Allocate() error = %v", err)
+	}
+	data := struct {
+		Budgets    prompt.Budgets
+		RAGContext string
+	}{budgets, strings.Repeat("Paris is the capital of France. ", 50)}
+	m, _, err := prompt.ParseMessages(`<user>{{limitTokens .RAGContext (.Budgets.Tokens "context")}}</user>`, data)
+	if err != nil {
+		t.Fatalf("ParseMessages() error = %v", err)
+	}
+	if c := tokenizer.Default().Count(m[0].Content); c > 50 {
+		t.Errorf("context has %d tokens, budget is 50", c)
+	}
+	if _, err := prompt.NewBudget(100, 100).Allocate(nil); err == nil {
+		t.Error("expected an error when the output reserves the whole window")
+	}
+}
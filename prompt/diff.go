@@ -0,0 +1,242 @@
+package prompt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yonidavidson/gopherconil.talk/tokenizer"
+)
+
+type (
+	// DiffOp is how a message or a line changed between two versions of a prompt.
+	DiffOp string
+
+	// Diff compares the messages of two versions of a prompt.
+	// Messages are matched by role, name and tool call ID, so a message whose role changed is removed and added.
+	Diff struct {
+		Messages             []MessageDiff
+		OldTokens, NewTokens int
+	}
+
+	// MessageDiff is a message of either version, Old is empty when it was added and New when it was removed.
+	MessageDiff struct {
+		Op                   DiffOp
+		Old, New             Message
+		OldTokens, NewTokens int
+		// Lines is the line diff of the content of a changed message
+		Lines []LineDiff
+	}
+
+	// LineDiff is a line of a changed message, its Op is DiffEqual, DiffAdded or DiffRemoved.
+	LineDiff struct {
+		Op   DiffOp
+		Text string
+	}
+)
+
+const (
+	DiffEqual   DiffOp = "equal"
+	DiffChanged DiffOp = "changed"
+	DiffAdded   DiffOp = "added"
+	DiffRemoved DiffOp = "removed"
+)
+
+// diffContext is the number of unchanged lines shown around the changes of a message.
+const diffContext = 2
+
+// DiffFiles renders two versions of a prompt file with the same data and compares their messages.
+// The data usually has the keys of both versions, so keys a version doesn't use aren't errors, even for strict files.
+func DiffFiles(before, after *File, data any) (*Diff, error) {
+	_, oldMessages, _, err := before.tmpl.run(before.Name, data, false)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering old version: %v", err)
+	}
+	_, newMessages, _, err := after.tmpl.run(after.Name, data, false)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering new version: %v", err)
+	}
+	return DiffMessages(oldMessages, newMessages), nil
+}
+
+// DiffMessages compares two versions of a list of messages.
+func DiffMessages(before, after []Message) *Diff {
+	enc := tokenizer.Default()
+	d := &Diff{}
+	pairs := lcs(before, after, func(a, b Message) bool {
+		return a.Role == b.Role && a.Name == b.Name && a.ToolCallID == b.ToolCallID
+	})
+	i, j := 0, 0
+	for _, p := range append(pairs, [2]int{len(before), len(after)}) {
+		for ; i < p[0]; i++ {
+			d.add(MessageDiff{Op: DiffRemoved, Old: before[i], OldTokens: enc.Count(before[i].Content)})
+		}
+		for ; j < p[1]; j++ {
+			d.add(MessageDiff{Op: DiffAdded, New: after[j], NewTokens: enc.Count(after[j].Content)})
+		}
+		if i == len(before) && j == len(after) {
+			break
+		}
+		md := MessageDiff{Op: DiffEqual, Old: before[i], New: after[j], OldTokens: enc.Count(before[i].Content), NewTokens: enc.Count(after[j].Content)}
+		if before[i].Content != after[j].Content {
+			md.Op = DiffChanged
+			md.Lines = diffLines(before[i].Content, after[j].Content)
+		}
+		d.add(md)
+		i, j = i+1, j+1
+	}
+	return d
+}
+
+func (d *Diff) add(md MessageDiff) {
+	d.Messages = append(d.Messages, md)
+	d.OldTokens += md.OldTokens
+	d.NewTokens += md.NewTokens
+}
+
+// Equal reports whether both versions have the same messages.
+func (d *Diff) Equal() bool {
+	for _, m := range d.Messages {
+		if m.Op != DiffEqual {
+			return false
+		}
+	}
+	return true
+}
+
+// String renders the diff for a review: a header per message with its token count and delta,
+// and for changed messages the changed lines with a little context.
+//
+//	=== system (12 tokens, unchanged)
+//	=== user (40 → 43 tokens, +3)
+//	  Context:
+//	- Answer briefly.
+//	+ Answer briefly and cite the context.
+//	+++ assistant (5 tokens, added)
+//	+ Hello!
+//	total: 2 → 3 messages, 52 → 60 tokens, +8
+func (d *Diff) String() string {
+	var sb strings.Builder
+	oldCount, newCount := 0, 0
+	for _, m := range d.Messages {
+		switch m.Op {
+		case DiffEqual:
+			fmt.Fprintf(&sb, "=== %s (%d tokens, unchanged)\n", header(m.New), m.NewTokens)
+		case DiffChanged:
+			fmt.Fprintf(&sb, "=== %s (%d → %d tokens, %+d)\n", header(m.New), m.OldTokens, m.NewTokens, m.NewTokens-m.OldTokens)
+			writeLines(&sb, m.Lines)
+		case DiffAdded:
+			fmt.Fprintf(&sb, "+++ %s (%d tokens, added)\n", header(m.New), m.NewTokens)
+			for _, line := range strings.Split(m.New.Content, "\n") {
+				sb.WriteString(strings.TrimRight("+ "+line, " ") + "\n")
+			}
+		case DiffRemoved:
+			fmt.Fprintf(&sb, "--- %s (%d tokens, removed)\n", header(m.Old), m.OldTokens)
+			for _, line := range strings.Split(m.Old.Content, "\n") {
+				sb.WriteString(strings.TrimRight("- "+line, " ") + "\n")
+			}
+		}
+		if m.Op != DiffAdded {
+			oldCount++
+		}
+		if m.Op != DiffRemoved {
+			newCount++
+		}
+	}
+	fmt.Fprintf(&sb, "total: %d → %d messages, %d → %d tokens, %+d\n", oldCount, newCount, d.OldTokens, d.NewTokens, d.NewTokens-d.OldTokens)
+	return sb.String()
+}
+
+// header names a message by its role and attributes.
+func header(m Message) string {
+	h := string(m.Role)
+	if m.Name != "" {
+		h += fmt.Sprintf(" name=%q", m.Name)
+	}
+	if m.ToolCallID != "" {
+		h += fmt.Sprintf(" id=%q", m.ToolCallID)
+	}
+	return h
+}
+
+// writeLines writes the changed lines and diffContext unchanged lines around them, longer unchanged runs are elided.
+func writeLines(sb *strings.Builder, lines []LineDiff) {
+	show := make([]bool, len(lines))
+	for i, l := range lines {
+		if l.Op == DiffEqual {
+			continue
+		}
+		for k := max(0, i-diffContext); k <= min(len(lines)-1, i+diffContext); k++ {
+			show[k] = true
+		}
+	}
+	elided := false
+	for i, l := range lines {
+		if !show[i] {
+			if !elided {
+				sb.WriteString("  …\n")
+			}
+			elided = true
+			continue
+		}
+		elided = false
+		prefix := "  "
+		switch l.Op {
+		case DiffAdded:
+			prefix = "+ "
+		case DiffRemoved:
+			prefix = "- "
+		}
+		sb.WriteString(strings.TrimRight(prefix+l.Text, " ") + "\n")
+	}
+}
+
+// diffLines compares two texts line by line.
+func diffLines(before, after string) []LineDiff {
+	a, b := strings.Split(before, "\n"), strings.Split(after, "\n")
+	var lines []LineDiff
+	i, j := 0, 0
+	for _, p := range append(lcs(a, b, func(x, y string) bool { return x == y }), [2]int{len(a), len(b)}) {
+		for ; i < p[0]; i++ {
+			lines = append(lines, LineDiff{Op: DiffRemoved, Text: a[i]})
+		}
+		for ; j < p[1]; j++ {
+			lines = append(lines, LineDiff{Op: DiffAdded, Text: b[j]})
+		}
+		if i < len(a) && j < len(b) {
+			lines = append(lines, LineDiff{Op: DiffEqual, Text: a[i]})
+			i, j = i+1, j+1
+		}
+	}
+	return lines
+}
+
+// lcs returns the index pairs of a longest common subsequence of a and b.
+func lcs[T any](a, b []T, eq func(x, y T) bool) [][2]int {
+	// n[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	n := make([][]int, len(a)+1)
+	for i := range n {
+		n[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if eq(a[i], b[j]) {
+				n[i][j] = n[i+1][j+1] + 1
+			} else {
+				n[i][j] = max(n[i+1][j], n[i][j+1])
+			}
+		}
+	}
+	var pairs [][2]int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case eq(a[i], b[j]):
+			pairs = append(pairs, [2]int{i, j})
+			i, j = i+1, j+1
+		case n[i+1][j] >= n[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return pairs
+}
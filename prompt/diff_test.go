@@ -0,0 +1,107 @@
+package prompt_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+	"github.com/yonidavidson/gopherconil.talk/tokenizer"
+)
+
+func TestDiffMessages(t *testing.T) {
+	before := []prompt.Message{
+		{Role: prompt.RoleSystem, Content: "Be brief."},
+		{Role: prompt.RoleUser, Content: "Context:\na\nb\nc\nd\ne\nf\nQuestion?"},
+		{Role: prompt.RoleTool, ToolCallID: "call_1", Content: "42"},
+	}
+	after := []prompt.Message{
+		{Role: prompt.RoleSystem, Content: "Be brief."},
+		{Role: prompt.RoleUser, Content: "Context:\na\nb\nc\nd\ne\nf\nQuestion, with sources?"},
+		{Role: prompt.RoleAssistant, Content: "Sure."},
+	}
+	d := prompt.DiffMessages(before, after)
+	if d.Equal() {
+		t.Errorf("expected a difference")
+	}
+	var ops []prompt.DiffOp
+	for _, m := range d.Messages {
+		ops = append(ops, m.Op)
+	}
+	if want := []prompt.DiffOp{prompt.DiffEqual, prompt.DiffChanged, prompt.DiffRemoved, prompt.DiffAdded}; !reflect.DeepEqual(ops, want) {
+		t.Errorf("ops = %v, want %v", ops, want)
+	}
+
+	count := tokenizer.Default().Count
+	oldUser, newUser := count(before[1].Content), count(after[1].Content)
+	oldTotal := count("Be brief.") + oldUser + count("42")
+	newTotal := count("Be brief.") + newUser + count("Sure.")
+	want := fmt.Sprintf(`=== system (%d tokens, unchanged)
+=== user (%d → %d tokens, %+d)
+  …
+  e
+  f
+- Question?
++ Question, with sources?
+--- tool id="call_1" (%d tokens, removed)
+- 42
++++ assistant (%d tokens, added)
++ Sure.
+total: 3 → 3 messages, %d → %d tokens, %+d
+`, count("Be brief."), oldUser, newUser, newUser-oldUser, count("42"), count("Sure."), oldTotal, newTotal, newTotal-oldTotal)
+	if got := d.String(); got != want {
+		t.Errorf("String() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDiffFiles(t *testing.T) {
+	before, err := prompt.ParseFile("rag", []byte("<system>Answer.</system>\n<user>{{.Query}}</user>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := prompt.ParseFile("rag", []byte("---\nmodel: gpt-4o\n---\n<system>Answer.</system>\n<user>{{.Query}}</user>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := prompt.DiffFiles(before, after, map[string]any{"Query": "Why?"})
+	if err != nil {
+		t.Fatalf("error diffing: %v", err)
+	}
+	if !d.Equal() {
+		t.Errorf("expected no difference, got\n%s", d)
+	}
+	if _, err := prompt.DiffFiles(before, after, map[string]any{}); err == nil {
+		t.Errorf("expected an error for missing data")
+	}
+}
+
+func TestDiffFilesAddedVariable(t *testing.T) {
+	before, err := prompt.ParseFile("rag", []byte("---\nstrict: true\n---\n<user>{{.Query}}</user>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := prompt.ParseFile("rag", []byte("---\nstrict: true\n---\n<user>{{.Query}}\nAnswer in {{.Language}}.</user>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]any{"Query": "Why?", "Language": "French"}
+	for _, tt := range []struct {
+		name          string
+		before, after *prompt.File
+		want          prompt.LineDiff
+	}{
+		{name: "added", before: before, after: after, want: prompt.LineDiff{Op: prompt.DiffAdded, Text: "Answer in French."}},
+		{name: "removed", before: after, after: before, want: prompt.LineDiff{Op: prompt.DiffRemoved, Text: "Answer in French."}},
+	} {
+		d, err := prompt.DiffFiles(tt.before, tt.after, data)
+		if err != nil {
+			t.Fatalf("%s: error diffing: %v", tt.name, err)
+		}
+		if len(d.Messages) != 1 || d.Messages[0].Op != prompt.DiffChanged {
+			t.Fatalf("%s: expected a changed message, got\n%s", tt.name, d)
+		}
+		if lines := d.Messages[0].Lines; len(lines) != 2 || lines[1] != tt.want {
+			t.Errorf("%s: lines = %v, want the second one %v", tt.name, lines, tt.want)
+		}
+	}
+}
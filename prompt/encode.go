@@ -0,0 +1,216 @@
+package prompt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type (
+	// jsonMessage is the OpenAI chat message format.
+	// Content is a string, null or an array of content parts, only the text parts are kept.
+	jsonMessage struct {
+		Role       Role            `json:"role"`
+		Content    json.RawMessage `json:"content"`
+		Name       string          `json:"name,omitempty"`
+		ToolCallID string          `json:"tool_call_id,omitempty"`
+		ToolCalls  []ToolCall      `json:"tool_calls,omitempty"`
+	}
+
+	// jsonToolCall is the OpenAI tool call format, only function tools are supported.
+	jsonToolCall struct {
+		ID       string `json:"id"`
+		Type     string `json:"type"`
+		Function struct {
+			Name      string `json:"name"`
+			Arguments string `json:"arguments"`
+		} `json:"function"`
+	}
+)
+
+// MarshalJSON encodes the message in the OpenAI chat format.
+func (m Message) MarshalJSON() ([]byte, error) {
+	content, err := json.Marshal(m.Content)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonMessage{Role: m.Role, Content: content, Name: m.Name, ToolCallID: m.ToolCallID, ToolCalls: m.ToolCalls})
+}
+
+// UnmarshalJSON decodes a message in the OpenAI chat format.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var jm jsonMessage
+	if err := json.Unmarshal(data, &jm); err != nil {
+		return err
+	}
+	if !roles[jm.Role] {
+		return fmt.Errorf("unknown role %q", jm.Role)
+	}
+	content, err := decodeContent(jm.Content)
+	if err != nil {
+		return err
+	}
+	if len(jm.ToolCalls) > 0 && jm.Role != RoleAssistant {
+		return fmt.Errorf("tool calls in a %s message", jm.Role)
+	}
+	*m = Message{Role: jm.Role, Content: content, Name: jm.Name, ToolCallID: jm.ToolCallID, ToolCalls: jm.ToolCalls}
+	return nil
+}
+
+// MarshalJSON encodes the tool call in the OpenAI format.
+func (c ToolCall) MarshalJSON() ([]byte, error) {
+	jc := jsonToolCall{ID: c.ID, Type: "function"}
+	jc.Function.Name, jc.Function.Arguments = c.Name, c.Arguments
+	return json.Marshal(jc)
+}
+
+// UnmarshalJSON decodes a tool call in the OpenAI format.
+func (c *ToolCall) UnmarshalJSON(data []byte) error {
+	var jc jsonToolCall
+	if err := json.Unmarshal(data, &jc); err != nil {
+		return err
+	}
+	if jc.Type != "function" {
+		return fmt.Errorf("unsupported tool call type %q", jc.Type)
+	}
+	if jc.ID == "" {
+		return fmt.Errorf("tool call is missing an id")
+	}
+	*c = ToolCall{ID: jc.ID, Name: jc.Function.Name, Arguments: jc.Function.Arguments}
+	return nil
+}
+
+func decodeContent(raw json.RawMessage) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return "", nil
+	}
+	if raw[0] != '[' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return "", fmt.Errorf("invalid content: %v", err)
+		}
+		return s, nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", fmt.Errorf("invalid content: %v", err)
+	}
+	var texts []string
+	for _, p := range parts {
+		if p.Type == "text" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// EncodeTagged writes messages in the role-tagged format read by DecodeTagged, one tag per line.
+// Contents and attributes are escaped, so DecodeTagged gives the messages back
+// with the whitespace around the contents trimmed. Templates include messages with Tagged instead.
+func EncodeTagged(w io.Writer, messages []Message) error {
+	return encodeTagged(w, messages, escaper.Replace)
+}
+
+// Tagged renders messages in the role-tagged format for a template, {{raw .History}} or a method returning Raw
+// adds them to the prompt. Unlike EncodeTagged, the escapes are delimited so ParseMessages decodes them.
+func Tagged(messages []Message) (Raw, error) {
+	var sb strings.Builder
+	if err := encodeTagged(&sb, messages, Escape); err != nil {
+		return "", err
+	}
+	return Raw(sb.String()), nil
+}
+
+// encodeTagged writes messages in the role-tagged format, escaping contents and attributes with escape.
+func encodeTagged(w io.Writer, messages []Message, escape func(string) string) error {
+	bw := bufio.NewWriter(w)
+	for _, m := range messages {
+		bw.WriteString("<" + string(m.Role))
+		if m.Name != "" {
+			bw.WriteString(` name="` + escape(m.Name) + `"`)
+		}
+		// only tool messages take an id, the parser rejects it on other roles
+		if m.Role == RoleTool && m.ToolCallID != "" {
+			bw.WriteString(` id="` + escape(m.ToolCallID) + `"`)
+		}
+		if m.Role == RoleAssistant && len(m.ToolCalls) > 0 {
+			calls, err := json.Marshal(m.ToolCalls)
+			if err != nil {
+				return err
+			}
+			bw.WriteString(` tool_calls="` + escape(string(calls)) + `"`)
+		}
+		bw.WriteString(">\n" + escape(m.Content) + "\n</" + string(m.Role) + ">\n")
+	}
+	return bw.Flush()
+}
+
+// DecodeTagged reads messages in the role-tagged format. The text isn't a template, so it may contain "{{".
+func DecodeTagged(r io.Reader) ([]Message, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	messages, _, err := parseMessages(string(b), unescaper.Replace, nil)
+	return messages, err
+}
+
+// EncodeJSON writes messages as an OpenAI style JSON array.
+func EncodeJSON(w io.Writer, messages []Message) error {
+	if messages == nil {
+		messages = []Message{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(messages)
+}
+
+// DecodeJSON reads a JSON array of OpenAI style messages.
+func DecodeJSON(r io.Reader) ([]Message, error) {
+	var messages []Message
+	if err := json.NewDecoder(r).Decode(&messages); err != nil {
+		return nil, fmt.Errorf("error decoding messages: %v", err)
+	}
+	return messages, nil
+}
+
+// EncodeJSONL writes one OpenAI style message per line.
+func EncodeJSONL(w io.Writer, messages []Message) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, m := range messages {
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecodeJSONL reads one OpenAI style message per line, blank lines are skipped.
+func DecodeJSONL(r io.Reader) ([]Message, error) {
+	var messages []Message
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var m Message
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			return nil, fmt.Errorf("error decoding message on line %d: %v", line, err)
+		}
+		messages = append(messages, m)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
@@ -0,0 +1,150 @@
+package prompt
+
+import (
+	"fmt"
+	"strings"
+	"text/template/parse"
+)
+
+// Raw is trusted prompt text, it is written to the prompt without escaping so it may contain role tags.
+// Templates produce it with {{raw .ChatHistory}}.
+type Raw string
+
+const (
+	// escapeFunc is the name of the function appended to every template action.
+	escapeFunc = "_escape"
+	// escapeStart and escapeEnd delimit escaped text in a rendered prompt, they are Unicode private use characters.
+	// Only the entities between them are decoded, so template text and Raw values are kept as written.
+	escapeStart = '\uE002'
+	escapeEnd   = '\uE003'
+)
+
+var (
+	// escaper escapes template data so it can't open or close messages.
+	// Every '<' is escaped, so tags can't be assembled from several values either,
+	// every '"' so data can't end an attribute value, and the private use characters the prompt uses
+	// so data can't fake node markers or the end of the escaped text.
+	escaper = strings.NewReplacer(
+		"&", "&amp;",
+		"<", "&lt;",
+		`"`, "&quot;",
+		string(markStart), "&#xE000;",
+		string(markEnd), "&#xE001;",
+		string(escapeStart), "&#xE002;",
+		string(escapeEnd), "&#xE003;",
+	)
+	// entities are the escapes and the text they stand for.
+	entities = []string{
+		"&amp;", "&",
+		"&lt;", "<",
+		"&quot;", `"`,
+		"&#xE000;", string(markStart),
+		"&#xE001;", string(markEnd),
+		"&#xE002;", string(escapeStart),
+		"&#xE003;", string(escapeEnd),
+	}
+	// unescaper decodes every escape, it reads the tagged format, which isn't a template.
+	unescaper = strings.NewReplacer(entities...)
+)
+
+// escapeValue is the template function added at the end of every action pipeline.
+func escapeValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case Raw:
+		return string(v)
+	case string:
+		return Escape(v)
+	}
+	return Escape(fmt.Sprint(v))
+}
+
+// raw marks a value as trusted prompt text.
+func raw(v any) Raw {
+	if s, ok := v.(string); ok {
+		return Raw(s)
+	}
+	return Raw(fmt.Sprint(v))
+}
+
+// Escape escapes text so it is read as message content and never as role tags.
+// The escaped text is delimited by the private use characters U+E002 and U+E003,
+// ParseMessages decodes the escapes between them only, so escaped text round-trips unchanged
+// and entities written in the template, such as &lt;, are kept.
+func Escape(text string) string {
+	if text == "" {
+		return ""
+	}
+	return string(escapeStart) + escaper.Replace(text) + string(escapeEnd)
+}
+
+// escapeAction makes an action escape its output, actions that only declare variables print nothing.
+func escapeAction(n *parse.ActionNode) {
+	if len(n.Pipe.Decl) > 0 {
+		return
+	}
+	n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+		NodeType: parse.NodeCommand,
+		Pos:      n.Pos,
+		Args:     []parse.Node{parse.NewIdentifier(escapeFunc).SetTree(nil).SetPos(n.Pos)},
+	})
+}
+
+// unescape decodes the escaped text of s and drops its delimiters, the rest of s is kept as is.
+func unescape(s string) string {
+	if !strings.ContainsRune(s, escapeStart) && !strings.ContainsRune(s, escapeEnd) {
+		return s
+	}
+	return decode(s, nil)
+}
+
+// unescapeOffsets is unescape, it also maps every offset of s, and its end, to an offset of the result.
+// An offset inside an entity or a delimiter maps to the start of the decoded text.
+func unescapeOffsets(s string) (string, []int) {
+	offsets := make([]int, len(s)+1)
+	return decode(s, offsets), offsets
+}
+
+// decode implements unescape, it fills offsets when they aren't nil.
+func decode(s string, offsets []int) string {
+	start, end := string(escapeStart), string(escapeEnd)
+	var sb strings.Builder
+	sb.Grow(len(s))
+	escaped := false
+	for i := 0; i < len(s); {
+		if offsets != nil {
+			offsets[i] = sb.Len()
+		}
+		n := 1
+		switch {
+		case strings.HasPrefix(s[i:], start):
+			escaped, n = true, len(start)
+		case strings.HasPrefix(s[i:], end):
+			escaped, n = false, len(end)
+		case escaped && s[i] == '&':
+			for k := 0; k < len(entities); k += 2 {
+				if strings.HasPrefix(s[i:], entities[k]) {
+					sb.WriteString(entities[k+1])
+					n = len(entities[k])
+					break
+				}
+			}
+			if n == 1 {
+				sb.WriteByte(s[i])
+			}
+		default:
+			sb.WriteByte(s[i])
+		}
+		if offsets != nil {
+			for j := i + 1; j < i+n; j++ {
+				offsets[j] = offsets[i]
+			}
+		}
+		i += n
+	}
+	if offsets != nil {
+		offsets[len(s)] = sb.Len()
+	}
+	return sb.String()
+}
@@ -0,0 +1,4 @@
+package prompt
+
+// LimitTokens exposes limitTokens to the fuzz tests.
+var LimitTokens = limitTokens
@@ -0,0 +1,114 @@
+package prompt
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is a .prompt file, a role-tagged template with the settings to run it in a YAML front matter:
+//
+//	---
+//	model: gpt-4o-mini
+//	temperature: 0.2
+//	max_tokens: 500
+//	required: [UserQuery]
+//	optional: [RAGContext]
+//	strict: true
+//	response_schema:
+//	  type: object
+//	  properties:
+//	    answer: {type: string}
+//	---
+//	<system>Answer in JSON.</system>
+//	<user>{{.UserQuery}}</user>
+//
+// Settings left out use the provider defaults.
+type File struct {
+	// Name is the file path without the extension, it names the template in error positions.
+	Name        string   `yaml:"-"`
+	Model       string   `yaml:"model"`
+	Temperature *float64 `yaml:"temperature"`
+	MaxTokens   int      `yaml:"max_tokens"`
+	// ResponseSchema is a JSON schema the model answer must follow.
+	ResponseSchema map[string]any `yaml:"response_schema"`
+	// Required and Optional declare the variables of the template in addition to the ones inferred from it,
+	// see ValidationError.
+	Required []string `yaml:"required"`
+	Optional []string `yaml:"optional"`
+	// Strict rejects data maps with keys the template doesn't use, which are usually misspelled variables.
+	Strict bool `yaml:"strict"`
+
+	tmpl *compiled
+}
+
+// frontMatterDelim opens and closes the front matter.
+const frontMatterDelim = "---"
+
+// LoadFile reads and parses a prompt file of fsys.
+func LoadFile(fsys fs.FS, name string) (*File, error) {
+	src, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("error reading prompt file: %v", err)
+	}
+	return ParseFile(strings.TrimSuffix(name, path.Ext(name)), src)
+}
+
+// ParseFile parses the content of a prompt file, the front matter is optional.
+func ParseFile(name string, src []byte) (*File, error) {
+	f := &File{Name: name}
+	header, body, lines, err := splitFrontMatter(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing prompt file %s: %v", name, err)
+	}
+	if header != "" {
+		dec := yaml.NewDecoder(strings.NewReader(header))
+		dec.KnownFields(true)
+		if err := dec.Decode(f); err != nil {
+			return nil, fmt.Errorf("error parsing front matter of %s: %v", name, err)
+		}
+	}
+	if lines > 0 {
+		// the comment stands in for the front matter so template lines match the file lines
+		body = "{{/*" + strings.Repeat("\n", lines-1) + "*/ -}}\n" + body
+	}
+	if err := checkVariables(append(f.Required, f.Optional...)); err != nil {
+		return nil, fmt.Errorf("error parsing front matter of %s: %v", name, err)
+	}
+	f.tmpl, err = compile(name, body)
+	if err != nil {
+		return nil, err
+	}
+	f.tmpl.vars[name].declare(f.Required, f.Optional)
+	f.tmpl.vars[name].strict = f.Strict
+	return f, nil
+}
+
+// splitFrontMatter returns the front matter, the template and the number of lines before the template.
+func splitFrontMatter(src string) (string, string, int, error) {
+	first, rest, _ := strings.Cut(src, "\n")
+	if strings.TrimRight(first, "\r") != frontMatterDelim {
+		return "", src, 0, nil
+	}
+	lines := 1
+	var header strings.Builder
+	for rest != "" {
+		var line string
+		line, rest, _ = strings.Cut(rest, "\n")
+		lines++
+		if strings.TrimRight(line, "\r") == frontMatterDelim {
+			return header.String(), rest, lines, nil
+		}
+		header.WriteString(line)
+		header.WriteByte('\n')
+	}
+	return "", "", 0, fmt.Errorf("front matter isn't closed with %s", frontMatterDelim)
+}
+
+// Render executes the template like ParseMessages.
+func (f *File) Render(data any) ([]Message, []byte, error) {
+	return f.tmpl.render(f.Name, data)
+}
@@ -0,0 +1,93 @@
+package prompt_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+)
+
+const promptFile = `---
+model: gpt-4o
+temperature: 0.2
+max_tokens: 300
+required: [UserQuery]
+response_schema:
+  type: object
+  properties:
+    answer: {type: string}
+---
+<system>Answer in JSON.</system>
+<user>{{.UserQuery}}</user>
+</assistant>
+`
+
+func TestLoadFile(t *testing.T) {
+	f, err := prompt.LoadFile(fstest.MapFS{"qa/answer.prompt": {Data: []byte(promptFile)}}, "qa/answer.prompt")
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if f.Name != "qa/answer" || f.Model != "gpt-4o" || *f.Temperature != 0.2 || f.MaxTokens != 300 {
+		t.Errorf("unexpected settings %+v", f)
+	}
+	if !reflect.DeepEqual(f.Required, []string{"UserQuery"}) {
+		t.Errorf("Required = %v", f.Required)
+	}
+	schema := map[string]any{"type": "object", "properties": map[string]any{"answer": map[string]any{"type": "string"}}}
+	if !reflect.DeepEqual(f.ResponseSchema, schema) {
+		t.Errorf("ResponseSchema = %v, want %v", f.ResponseSchema, schema)
+	}
+
+	// the stray closing tag is reported at its line in the file
+	_, _, err = f.Render(map[string]string{"UserQuery": "hi"})
+	if err == nil || !strings.HasSuffix(err.Error(), "(template qa/answer:13:1)") {
+		t.Errorf("Render() error = %v", err)
+	}
+	_, _, err = f.Render(map[string]string{})
+	if err == nil || err.Error() != "invalid template data: missing variables UserQuery" {
+		t.Errorf("Render() error = %v", err)
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected []prompt.Message
+		wantErr  bool
+	}{
+		{
+			name:     "no front matter",
+			src:      "<user>hi</user>",
+			expected: []prompt.Message{{Role: prompt.RoleUser, Content: "hi"}},
+		},
+		{
+			name:     "empty front matter",
+			src:      "---\n---\n<user>hi</user>",
+			expected: []prompt.Message{{Role: prompt.RoleUser, Content: "hi"}},
+		},
+		{name: "unknown setting", src: "---\nmodle: gpt-4o\n---\n<user>hi</user>", wantErr: true},
+		{name: "unclosed front matter", src: "---\nmodel: gpt-4o\n<user>hi</user>", wantErr: true},
+		{name: "invalid template", src: "---\n---\n<user>{{</user>", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := prompt.ParseFile("test", []byte(tt.src))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got, _, err := f.Render(nil)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Render() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
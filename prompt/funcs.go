@@ -0,0 +1,177 @@
+package prompt
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/yonidavidson/gopherconil.talk/tokenizer"
+)
+
+// Passage is a retrieved text rendered by the chunks template function, Source is optional.
+type Passage struct {
+	Source string
+	Text   string
+}
+
+// toJSON encodes v as compact JSON: {{toJSON .Schema}}.
+func toJSON(v any) (string, error) {
+	var sb strings.Builder
+	enc := json.NewEncoder(&sb)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", fmt.Errorf("toJSON: %v", err)
+	}
+	return strings.TrimSuffix(sb.String(), "\n"), nil
+}
+
+// indent prefixes every non-empty line of s with n spaces: {{.Code | indent 4}}.
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = pad + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// join joins the items of a slice with sep: {{.Tags | join ", "}}.
+func join(sep string, items any) (string, error) {
+	s, err := toStrings("join", items)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(s, sep), nil
+}
+
+// truncateWords keeps the first n words of s and marks the cut with "…": {{truncateWords 50 .Bio}}.
+// Whitespace between the kept words is preserved.
+func truncateWords(n int, s string) string {
+	words := 0
+	inWord := false
+	for i, r := range s {
+		space := r == ' ' || r == '\t' || r == '\n' || r == '\r'
+		if !space && !inWord {
+			if words == n {
+				return strings.TrimRight(s[:i], " \t\n\r") + "…"
+			}
+			words++
+		}
+		inWord = !space
+	}
+	return s
+}
+
+// countTokens returns the number of tokens of s: {{countTokens .RAGContext}}.
+func countTokens(s string) int {
+	return tokenizer.Default().Count(s)
+}
+
+// now returns the current time, for use with date: {{now | date "2006-01-02"}}.
+func now() time.Time {
+	return time.Now()
+}
+
+// date formats t with a Go layout, or one of the names RFC3339, RFC1123 and DateOnly: {{date "DateOnly" .Due}}.
+func date(layout string, t time.Time) string {
+	switch layout {
+	case "RFC3339":
+		layout = time.RFC3339
+	case "RFC1123":
+		layout = time.RFC1123
+	case "DateOnly":
+		layout = time.DateOnly
+	}
+	return t.Format(layout)
+}
+
+// defaultValue returns v, or def when v is missing or empty: {{.Tone | default "friendly"}}.
+// Fields passed to default are optional, see ValidationError.
+func defaultValue(def, v any) any {
+	if v == nil {
+		return def
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		if rv.Len() == 0 {
+			return def
+		}
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return def
+		}
+	}
+	return v
+}
+
+// bullets renders the items of a slice as a Markdown list: {{bullets .Steps}}.
+func bullets(items any) (string, error) {
+	s, err := toStrings("bullets", items)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for i, item := range s {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		// continuation lines are indented under the item
+		sb.WriteString("- " + strings.TrimPrefix(indent(2, item), "  "))
+	}
+	return sb.String(), nil
+}
+
+// chunks renders retrieved passages, strings or Passage values, with citation IDs [1], [2]… the model can quote:
+// {{chunks .Passages}}.
+func chunks(passages any) (string, error) {
+	if passages == nil {
+		return "", nil
+	}
+	rv := reflect.ValueOf(passages)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return "", fmt.Errorf("chunks: want a slice, got %T", passages)
+	}
+	parts := make([]string, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		var p Passage
+		switch v := rv.Index(i).Interface().(type) {
+		case Passage:
+			p = v
+		case string:
+			p = Passage{Text: v}
+		default:
+			p = Passage{Text: fmt.Sprint(v)}
+		}
+		text := strings.TrimSpace(p.Text)
+		if p.Source != "" {
+			parts = append(parts, fmt.Sprintf("[%d] (%s) %s", i+1, p.Source, text))
+		} else {
+			parts = append(parts, fmt.Sprintf("[%d] %s", i+1, text))
+		}
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// toStrings formats the items of a slice, a single string is a slice of one.
+func toStrings(fn string, items any) ([]string, error) {
+	if items == nil {
+		return nil, nil
+	}
+	if s, ok := items.(string); ok {
+		return []string{s}, nil
+	}
+	rv := reflect.ValueOf(items)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%s: want a slice, got %T", fn, items)
+	}
+	s := make([]string, rv.Len())
+	for i := range s {
+		s[i] = fmt.Sprint(rv.Index(i).Interface())
+	}
+	return s, nil
+}
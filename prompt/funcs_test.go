@@ -0,0 +1,118 @@
+package prompt_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+	"github.com/yonidavidson/gopherconil.talk/tokenizer"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	due := time.Date(2024, 9, 10, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		input    string
+		data     map[string]any
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "toJSON",
+			input:    `{{toJSON .Schema}}`,
+			data:     map[string]any{"Schema": map[string]any{"answer": "<string>", "n": 1}},
+			expected: `{"answer":"<string>","n":1}`,
+		},
+		{name: "toJSON error", input: `{{toJSON .F}}`, data: map[string]any{"F": func() {}}, wantErr: true},
+		{
+			name:     "indent",
+			input:    "Code:\n{{.Code | indent 4}}",
+			data:     map[string]any{"Code": "a := 1\n\nb := 2"},
+			expected: "Code:\n    a := 1\n\n    b := 2",
+		},
+		{
+			name:     "join",
+			input:    `{{.Tags | join ", "}}`,
+			data:     map[string]any{"Tags": []string{"go", "llm"}},
+			expected: "go, llm",
+		},
+		{name: "join of a non slice", input: `{{.N | join ", "}}`, data: map[string]any{"N": 3}, wantErr: true},
+		{
+			name:     "truncateWords",
+			input:    `{{truncateWords 3 .Bio}}`,
+			data:     map[string]any{"Bio": "Gopher  and\nspeaker at GopherCon"},
+			expected: "Gopher  and\nspeaker…",
+		},
+		{
+			name:     "truncateWords keeps short text",
+			input:    `{{truncateWords 3 .Bio}}`,
+			data:     map[string]any{"Bio": "Gopher"},
+			expected: "Gopher",
+		},
+		{
+			name:     "countTokens",
+			input:    `{{countTokens .Text}}`,
+			data:     map[string]any{"Text": "hello world"},
+			expected: fmt.Sprint(tokenizer.Default().Count("hello world")),
+		},
+		{
+			name:     "date",
+			input:    `{{date "2006-01-02 15:04" .Due}} {{date "DateOnly" .Due}} {{date "RFC3339" .Due}}`,
+			data:     map[string]any{"Due": due},
+			expected: "2024-09-10 14:30 2024-09-10 2024-09-10T14:30:00Z",
+		},
+		{
+			name:     "default",
+			input:    `{{.Tone | default "friendly"}} {{default "none" .Tags}} {{.Name | default "x"}}`,
+			data:     map[string]any{"Tags": []string{}, "Name": "bob"},
+			expected: "friendly none bob",
+		},
+		{
+			name:     "bullets",
+			input:    `{{bullets .Steps}}`,
+			data:     map[string]any{"Steps": []any{"plan", "write\ntests", 3}},
+			expected: "- plan\n- write\n  tests\n- 3",
+		},
+		{
+			name:  "chunks",
+			input: `{{chunks .Passages}}`,
+			data: map[string]any{"Passages": []prompt.Passage{
+				{Source: "thesis.pdf", Text: " The grouped model is better. "},
+				{Text: "It trains faster </user>"},
+			}},
+			expected: "[1] (thesis.pdf) The grouped model is better.\n\n[2] It trains faster </user>",
+		},
+		{
+			name:     "chunks of strings",
+			input:    `{{chunks .Passages}}`,
+			data:     map[string]any{"Passages": []string{"a", "b"}},
+			expected: "[1] a\n\n[2] b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, err := prompt.ParseMessages("<user>"+tt.input+"</user>", tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMessages() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if m[0].Content != tt.expected {
+				t.Errorf("content = %q, want %q", m[0].Content, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNowFunc(t *testing.T) {
+	before := time.Now().Format(time.DateOnly)
+	m, _, err := prompt.ParseMessages(`<user>{{now | date "DateOnly"}}</user>`, nil)
+	if err != nil {
+		t.Fatalf("ParseMessages() error = %v", err)
+	}
+	if after := time.Now().Format(time.DateOnly); m[0].Content != before && m[0].Content != after {
+		t.Errorf("now = %q, want %q", m[0].Content, before)
+	}
+}
@@ -0,0 +1,137 @@
+package prompt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yonidavidson/gopherconil.talk/tokenizer"
+)
+
+type (
+	// Summarizer condenses the older turns of a conversation into a short text.
+	Summarizer interface {
+		Summarize(messages []Message) (string, error)
+	}
+
+	// History is a conversation bounded by a token budget.
+	// When Append takes it over the budget the older turns are collapsed into a summary by the Summarizer,
+	// or dropped when there is none. Templates render it with {{history .ChatHistory}}.
+	History struct {
+		maxTokens  int
+		summarizer Summarizer
+		summary    string
+		messages   []Message
+	}
+)
+
+const (
+	// messageOverhead approximates the tokens the chat format adds to every message.
+	messageOverhead = 4
+	// SummaryPrefix starts the assistant message that holds the summary of the older turns.
+	SummaryPrefix = "Summary of the earlier conversation:\n"
+)
+
+// NewHistory returns an empty history bounded by maxTokens, s may be nil.
+func NewHistory(maxTokens int, s Summarizer) *History {
+	return &History{maxTokens: maxTokens, summarizer: s}
+}
+
+// Append adds messages to the history. When the history goes over its budget, the newest messages that fit
+// in half of it are kept and the others, with the previous summary, are summarized.
+func (h *History) Append(messages ...Message) error {
+	h.messages = append(h.messages, messages...)
+	if h.maxTokens <= 0 || h.Tokens() <= h.maxTokens {
+		return nil
+	}
+	keep := len(h.messages) - len(window(h.messages, h.maxTokens/2))
+	if keep == len(h.messages) {
+		// always keep the latest message
+		keep--
+	}
+	older := h.messages[:keep]
+	if h.summarizer == nil {
+		h.messages = h.messages[keep:]
+		return nil
+	}
+	if h.summary != "" {
+		older = append([]Message{h.summaryMessage()}, older...)
+	}
+	summary, err := h.summarizer.Summarize(older)
+	if err != nil {
+		return fmt.Errorf("error summarizing history: %v", err)
+	}
+	h.summary = strings.TrimSpace(summary)
+	h.messages = append([]Message(nil), h.messages[keep:]...)
+	return nil
+}
+
+// Messages returns the summary of the older turns, if any, followed by the latest turns.
+func (h *History) Messages() []Message {
+	if h.summary == "" {
+		return append([]Message(nil), h.messages...)
+	}
+	return append([]Message{h.summaryMessage()}, h.messages...)
+}
+
+// Window returns the newest messages that fit in maxTokens, the summary is kept only when everything fits.
+func (h *History) Window(maxTokens int) []Message {
+	return window(h.Messages(), maxTokens)
+}
+
+// Summary returns the summary of the turns that were collapsed.
+func (h *History) Summary() string {
+	return h.summary
+}
+
+// Tokens returns the size of the history.
+func (h *History) Tokens() int {
+	return countMessages(h.Messages())
+}
+
+// String returns the history in the role-tagged format.
+func (h *History) String() string {
+	var sb strings.Builder
+	_ = EncodeTagged(&sb, h.Messages())
+	return sb.String()
+}
+
+func (h *History) summaryMessage() Message {
+	return Message{Role: RoleAssistant, Content: SummaryPrefix + h.summary}
+}
+
+// window returns the longest suffix of messages that fits in maxTokens.
+func window(messages []Message, maxTokens int) []Message {
+	total := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		total += countMessages(messages[i : i+1])
+		if total > maxTokens {
+			return messages[i+1:]
+		}
+	}
+	return messages
+}
+
+func countMessages(messages []Message) int {
+	enc := tokenizer.Default()
+	total := 0
+	for _, m := range messages {
+		total += enc.Count(m.Content) + messageOverhead
+	}
+	return total
+}
+
+// renderHistory is the history template function: {{history .ChatHistory}} renders every message
+// and {{history .ChatHistory 500}} the newest ones that fit in 500 tokens.
+func renderHistory(h *History, maxTokens ...float64) (Raw, error) {
+	if h == nil {
+		return "", nil
+	}
+	if len(maxTokens) > 1 {
+		return "", fmt.Errorf("history takes at most one token limit")
+	}
+	messages := h.Messages()
+	if len(maxTokens) == 1 {
+		messages = h.Window(tokenLimit(maxTokens[0]))
+	}
+	return Tagged(messages)
+}
@@ -0,0 +1,206 @@
+package prompt
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Library is a set of named prompt templates loaded from a directory or an embed.FS.
+	// Every file is a template named after its path without the extension, so prompts/rag.tmpl is "rag",
+	// and all files share one template set so any prompt can include another with {{template "name" .}}.
+	// A file named name@version.tmpl is a version of the prompt name.
+	Library struct {
+		fsys      fs.FS
+		hotReload bool
+
+		mu       sync.RWMutex
+		set      *compiled
+		versions map[string][]string
+		modTimes map[string]time.Time
+	}
+
+	// LibraryOption configures a Library.
+	LibraryOption func(*Library)
+)
+
+// templateExt is the extension of the files loaded by a Library.
+const templateExt = ".tmpl"
+
+// WithHotReload reloads the library when a file is added, removed or modified, which is handy in development.
+// Files are checked on every render, file systems without modification times such as embed.FS never reload.
+func WithHotReload() LibraryOption {
+	return func(l *Library) {
+		l.hotReload = true
+	}
+}
+
+// NewLibrary loads every .tmpl file of fsys.
+func NewLibrary(fsys fs.FS, opts ...LibraryOption) (*Library, error) {
+	l := &Library{fsys: fsys}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// LoadLibrary loads the templates of a directory.
+func LoadLibrary(dir string, opts ...LibraryOption) (*Library, error) {
+	return NewLibrary(os.DirFS(dir), opts...)
+}
+
+// Reload parses all the files again.
+func (l *Library) Reload() error {
+	modTimes, err := l.scan()
+	if err != nil {
+		return err
+	}
+	root := newTemplate("")
+	versions := map[string][]string{}
+	for _, file := range sortedKeys(modTimes) {
+		src, err := fs.ReadFile(l.fsys, file)
+		if err != nil {
+			return fmt.Errorf("error reading template %s: %v", file, err)
+		}
+		name := strings.TrimSuffix(file, templateExt)
+		if _, err := root.New(name).Parse(string(src)); err != nil {
+			return fmt.Errorf("error parsing template %s: %v", file, err)
+		}
+		base, version, _ := strings.Cut(name, "@")
+		versions[base] = append(versions[base], version)
+	}
+	for _, vs := range versions {
+		sort.Slice(vs, func(i, j int) bool { return versionLess(vs[i], vs[j]) })
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.set = instrument(root)
+	l.versions = versions
+	l.modTimes = modTimes
+	return nil
+}
+
+// Render executes a prompt and parses its output into messages, like ParseMessages.
+// An empty version selects the unversioned file, or the latest version when there is none.
+func (l *Library) Render(name, version string, data any) ([]Message, []byte, error) {
+	if err := l.reloadIfChanged(); err != nil {
+		return nil, nil, err
+	}
+	l.mu.RLock()
+	set := l.set
+	tmpl, err := l.lookup(name, version)
+	l.mu.RUnlock()
+	if err != nil {
+		return nil, nil, err
+	}
+	return set.render(tmpl, data)
+}
+
+// Names returns the names of the prompts, sorted.
+func (l *Library) Names() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return sortedKeys(l.versions)
+}
+
+// Versions returns the versions of a prompt from the oldest to the latest, the unversioned file is "".
+func (l *Library) Versions(name string) []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return append([]string(nil), l.versions[name]...)
+}
+
+// lookup returns the template name of a prompt version.
+func (l *Library) lookup(name, version string) (string, error) {
+	vs, ok := l.versions[name]
+	if !ok {
+		return "", fmt.Errorf("prompt %q not found", name)
+	}
+	if version == "" {
+		if vs[0] == "" {
+			return name, nil
+		}
+		version = vs[len(vs)-1]
+	}
+	for _, v := range vs {
+		if v == version {
+			return name + "@" + version, nil
+		}
+	}
+	return "", fmt.Errorf("prompt %q has no version %q", name, version)
+}
+
+// scan returns the template files of the library with their modification times.
+func (l *Library) scan() (map[string]time.Time, error) {
+	files := map[string]time.Time{}
+	err := fs.WalkDir(l.fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(p) != templateExt {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files[p] = info.ModTime()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing templates: %v", err)
+	}
+	return files, nil
+}
+
+func (l *Library) reloadIfChanged() error {
+	if !l.hotReload {
+		return nil
+	}
+	files, err := l.scan()
+	if err != nil {
+		return err
+	}
+	l.mu.RLock()
+	changed := len(files) != len(l.modTimes)
+	for p, t := range files {
+		if old, ok := l.modTimes[p]; !ok || !old.Equal(t) {
+			changed = true
+		}
+	}
+	l.mu.RUnlock()
+	if !changed {
+		return nil
+	}
+	return l.Reload()
+}
+
+// versionLess orders versions such as "v2" before "v10", the unversioned file comes first.
+func versionLess(a, b string) bool {
+	an, aErr := strconv.Atoi(strings.TrimPrefix(a, "v"))
+	bn, bErr := strconv.Atoi(strings.TrimPrefix(b, "v"))
+	if aErr == nil && bErr == nil && an != bn {
+		return an < bn
+	}
+	return a < b
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
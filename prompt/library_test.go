@@ -0,0 +1,115 @@
+package prompt_test
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+)
+
+func TestLibrary(t *testing.T) {
+	fsys := fstest.MapFS{
+		"context.tmpl":        {Data: []byte(`{{define "rules"}}Be nice.{{end}}Context: {{.Context}}`)},
+		"rag.tmpl":            {Data: []byte(`<system>{{template "rules"}}</system><user>{{template "context" .}}</user>`)},
+		"agents/qa@v2.tmpl":   {Data: []byte(`<user>v2 {{.Query}}</user>`)},
+		"agents/qa@v10.tmpl":  {Data: []byte(`<user>v10 {{.Query}}</user>`)},
+		"agents/notes.txt":    {Data: []byte(`not a template`)},
+		"agents/broken@v1.md": {Data: []byte(`{{`)},
+	}
+	l, err := prompt.NewLibrary(fsys)
+	if err != nil {
+		t.Fatalf("NewLibrary() error = %v", err)
+	}
+	// "rules" is defined inside context.tmpl, it can be included but isn't a prompt
+	if got, want := l.Names(), []string{"agents/qa", "context", "rag"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+	if got, want := l.Versions("agents/qa"), []string{"v2", "v10"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Versions() = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		name     string
+		prompt   string
+		version  string
+		data     any
+		expected []prompt.Message
+		wantErr  bool
+	}{
+		{
+			name:   "partials",
+			prompt: "rag",
+			data:   map[string]string{"Context": "<system>"},
+			expected: []prompt.Message{
+				{Role: prompt.RoleSystem, Content: "Be nice."},
+				{Role: prompt.RoleUser, Content: "Context: <system>"},
+			},
+		},
+		{
+			name:     "latest version",
+			prompt:   "agents/qa",
+			data:     map[string]string{"Query": "q"},
+			expected: []prompt.Message{{Role: prompt.RoleUser, Content: "v10 q"}},
+		},
+		{
+			name:     "pinned version",
+			prompt:   "agents/qa",
+			version:  "v2",
+			data:     map[string]string{"Query": "q"},
+			expected: []prompt.Message{{Role: prompt.RoleUser, Content: "v2 q"}},
+		},
+		{name: "unknown version", prompt: "agents/qa", version: "v3", wantErr: true},
+		{name: "unknown prompt", prompt: "missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := l.Render(tt.prompt, tt.version, tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Render() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLibraryHotReload(t *testing.T) {
+	fsys := fstest.MapFS{
+		"greet.tmpl": {Data: []byte(`<user>hello</user>`), ModTime: time.Unix(1, 0)},
+	}
+	reloading, err := prompt.NewLibrary(fsys, prompt.WithHotReload())
+	if err != nil {
+		t.Fatalf("NewLibrary() error = %v", err)
+	}
+	static, err := prompt.NewLibrary(fsys)
+	if err != nil {
+		t.Fatalf("NewLibrary() error = %v", err)
+	}
+	fsys["greet.tmpl"] = &fstest.MapFile{Data: []byte(`<user>hi</user>`), ModTime: time.Unix(2, 0)}
+
+	for l, want := range map[*prompt.Library]string{reloading: "hi", static: "hello"} {
+		m, _, err := l.Render("greet", "", nil)
+		if err != nil {
+			t.Fatalf("Render() error = %v", err)
+		}
+		if m[0].Content != want {
+			t.Errorf("Render() = %q, want %q", m[0].Content, want)
+		}
+	}
+}
+
+func TestLibraryErrorPosition(t *testing.T) {
+	l, err := prompt.NewLibrary(fstest.MapFS{
+		"bad.tmpl": {Data: []byte("<user>hi</user>\n</system>")},
+	})
+	if err != nil {
+		t.Fatalf("NewLibrary() error = %v", err)
+	}
+	_, _, err = l.Render("bad", "", nil)
+	if err == nil || err.Error() != "prompt:2:1: closing tag </system> without an opening tag (template bad:2:1)" {
+		t.Errorf("Render() error = %v", err)
+	}
+}
@@ -0,0 +1,384 @@
+package prompt
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/yonidavidson/gopherconil.talk/tokenizer"
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// Diagnostic is a problem found by Lint, it prints as file:line:col: rule: message.
+	Diagnostic struct {
+		Pos  Position
+		Rule string
+		Msg  string
+	}
+
+	// LintOptions configure the checks that need more than the template source.
+	LintOptions struct {
+		// Data is a fixture the template is rendered with, to check the data and the size of the prompt.
+		// A fixture is often shared by several templates, so keys a template doesn't use aren't reported.
+		// Without it only the static text of the template counts toward the context window.
+		Data any
+		// Model is used when the file doesn't set one.
+		Model string
+		// ContextWindow returns the number of tokens a model accepts, the size isn't checked when it is nil.
+		ContextWindow func(model string) int
+	}
+
+	// action is a {{...}} of a template source, start and end are byte offsets.
+	action struct {
+		start, end int
+		keyword    string
+		comment    bool
+	}
+
+	// linter collects the diagnostics of a file.
+	linter struct {
+		name  string
+		src   string
+		diags []Diagnostic
+	}
+)
+
+// Lint rules. RuleUnusedVariable and RuleUndeclaredVariable compare the variables a template uses with the ones
+// its front matter declares, they don't run for templates that declare none, such as .tmpl files.
+const (
+	RuleSyntax             = "syntax"
+	RuleFrontMatter        = "front-matter"
+	RuleUnbalancedTag      = "unbalanced-tag"
+	RuleStrayText          = "stray-text"
+	RuleEmptyMessage       = "empty-message"
+	RuleSystemNotFirst     = "system-not-first"
+	RuleRepeatedRole       = "repeated-role"
+	RuleUnusedVariable     = "unused-variable"
+	RuleUndeclaredVariable = "undeclared-variable"
+	RuleRender             = "render"
+	RuleContextWindow      = "context-window"
+)
+
+// templateErrorRE matches the position text/template puts in its errors: template: name:line[:column]: message.
+var templateErrorRE = regexp.MustCompile(`template: .*?:(\d+)(?::(\d+))?: (.*)$`)
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Pos, d.Rule, d.Msg)
+}
+
+// Lint checks a prompt file, see ParseFile, and returns its problems sorted by position.
+// The role tags of the template are checked statically: since data is escaped, only the template text can write them.
+// Messages separated by an action that may render other messages, such as {{if}} or {{raw .History}},
+// aren't checked for repeated roles.
+// The variables are checked when the front matter declares some: every declared variable must be used,
+// and every used variable must be declared. Without declarations there is nothing to compare the used
+// variables with, so only rendering the data fixture checks them.
+func Lint(name string, src []byte, opts LintOptions) []Diagnostic {
+	l := &linter{name: name, src: string(src)}
+	header, body, lines, err := splitFrontMatter(l.src)
+	if err != nil {
+		l.report(l.pos(0), RuleFrontMatter, "%s", err.Error())
+		return l.diags
+	}
+	f, err := ParseFile(name, src)
+	if err != nil {
+		l.reportError(err, lines)
+		return l.diags
+	}
+	offset := len(l.src) - len(body)
+	blank := l.lintTags(offset)
+	if len(f.Required)+len(f.Optional) > 0 {
+		l.lintVariables(f, header)
+	}
+	if opts.ContextWindow != nil {
+		l.lintSize(f, opts, blank[offset:], lines)
+	}
+	sort.SliceStable(l.diags, func(i, j int) bool {
+		a, b := l.diags[i].Pos, l.diags[j].Pos
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return l.diags
+}
+
+func (l *linter) report(pos Position, rule, format string, args ...any) {
+	l.diags = append(l.diags, Diagnostic{Pos: pos, Rule: rule, Msg: fmt.Sprintf(format, args...)})
+}
+
+// pos returns the position of a byte offset of the file.
+func (l *linter) pos(offset int) Position {
+	line, col := lineColumn(l.src, offset)
+	return Position{Name: l.name, Line: line, Column: col}
+}
+
+// reportError reports an error of ParseFile or of rendering at the position it carries, or at the start of the template.
+func (l *linter) reportError(err error, lines int) {
+	var syntax *SyntaxError
+	if errors.As(err, &syntax) {
+		pos := Position{Name: l.name, Line: lines + 1, Column: 1}
+		if syntax.Template != nil {
+			pos = *syntax.Template
+		}
+		l.report(pos, RuleRender, "%s", syntax.Msg)
+		return
+	}
+	msg := err.Error()
+	rule := RuleRender
+	switch {
+	case strings.HasPrefix(msg, "error parsing front matter"):
+		l.report(l.pos(0), RuleFrontMatter, "%s", msg)
+		return
+	case strings.HasPrefix(msg, "error parsing template"):
+		rule = RuleSyntax
+	}
+	pos := Position{Name: l.name, Line: lines + 1, Column: 1}
+	if m := templateErrorRE.FindStringSubmatch(msg); m != nil {
+		pos.Line, _ = strconv.Atoi(m[1])
+		pos.Column = 1
+		if m[2] != "" {
+			pos.Column, _ = strconv.Atoi(m[2])
+		}
+		msg = m[3]
+	}
+	l.report(pos, rule, "%s", msg)
+}
+
+// lintTags checks the messages written by the template text, the front matter ends at offset.
+// It returns the source with the front matter and the actions replaced by spaces.
+func (l *linter) lintTags(offset int) string {
+	actions := scanActions(l.src, offset)
+	b := []byte(l.src)
+	blankOut := func(start, end int) {
+		for i := start; i < end; i++ {
+			if b[i] != '\n' {
+				b[i] = ' '
+			}
+		}
+	}
+	blankOut(0, offset)
+	for _, a := range actions {
+		blankOut(a.start, a.end)
+	}
+	blank := string(b)
+
+	// between returns the actions between two offsets
+	next := 0
+	between := func(start, end int) []action {
+		for next < len(actions) && actions[next].end <= start {
+			next++
+		}
+		k := next
+		for k < len(actions) && actions[k].start < end {
+			k++
+		}
+		return actions[next:k]
+	}
+
+	var open, prev *token
+	// other tells whether a message other than system or developer may be rendered before the current one
+	other := false
+	lastEnd := offset
+	for _, t := range scan(blank, unescape) {
+		t := t
+		switch t.kind {
+		case tokenText:
+			if open != nil {
+				continue
+			}
+			text := blank[t.start:t.end]
+			if i := strings.IndexFunc(text, func(r rune) bool { return !unicode.IsSpace(r) }); i >= 0 {
+				l.report(l.pos(t.start+i), RuleStrayText, "text outside of a message: %q", excerpt(strings.TrimSpace(text[i:])))
+			}
+		case tokenOpen:
+			if t.err != "" {
+				// still open the message so its closing tag doesn't report again
+				l.report(l.pos(t.start), RuleUnbalancedTag, "%s", t.err)
+			}
+			if open != nil {
+				line, col := lineColumn(l.src, open.start)
+				l.report(l.pos(t.start), RuleUnbalancedTag, "<%s> nested inside <%s> opened at %d:%d", t.role, open.role, line, col)
+			}
+			for _, a := range between(lastEnd, t.start) {
+				if !a.comment {
+					prev = nil
+				}
+				if a.keyword == "else" || a.keyword == "define" || a.keyword == "block" {
+					other = false
+				}
+			}
+			if prev != nil && prev.role == t.role && prev.name == t.name && t.role != RoleTool {
+				line, col := lineColumn(l.src, prev.start)
+				l.report(l.pos(t.start), RuleRepeatedRole, "<%s> follows the <%s> message at %d:%d, merge them or add the other role between", t.role, prev.role, line, col)
+			}
+			if (t.role == RoleSystem || t.role == RoleDeveloper) && other {
+				l.report(l.pos(t.start), RuleSystemNotFirst, "<%s> comes after a user, assistant or tool message", t.role)
+			}
+			open = &t
+		case tokenClose:
+			if t.err != "" {
+				l.report(l.pos(t.start), RuleUnbalancedTag, "%s", t.err)
+				continue
+			}
+			if open == nil {
+				l.report(l.pos(t.start), RuleUnbalancedTag, "closing tag </%s> without an opening tag", t.role)
+				continue
+			}
+			if t.role != open.role {
+				line, col := lineColumn(l.src, open.start)
+				l.report(l.pos(t.start), RuleUnbalancedTag, "mismatched closing tag </%s> for <%s> opened at %d:%d", t.role, open.role, line, col)
+			}
+			empty := strings.TrimSpace(blank[open.end:t.start]) == ""
+			for _, a := range between(open.end, t.start) {
+				empty = empty && a.comment
+			}
+			if empty {
+				l.report(l.pos(open.start), RuleEmptyMessage, "<%s> message is empty", open.role)
+			}
+			if open.role != RoleSystem && open.role != RoleDeveloper {
+				other = true
+			}
+			prev, open = open, nil
+			lastEnd = t.end
+		}
+	}
+	if open != nil {
+		l.report(l.pos(open.start), RuleUnbalancedTag, "unclosed tag <%s>", open.role)
+	}
+	return blank
+}
+
+// lintVariables compares the variables declared in the front matter with the ones the template uses.
+func (l *linter) lintVariables(f *File, header string) {
+	vars := f.tmpl.vars[f.Name]
+	declared := map[string]bool{}
+	var doc yaml.Node
+	_ = yaml.Unmarshal([]byte(header), &doc)
+	if len(doc.Content) > 0 {
+		m := doc.Content[0]
+		for i := 0; i+1 < len(m.Content); i += 2 {
+			if key := m.Content[i].Value; key != "required" && key != "optional" {
+				continue
+			}
+			for _, item := range m.Content[i+1].Content {
+				declared[item.Value] = true
+				if _, ok := vars.used[item.Value]; !ok {
+					// the header starts on the line after the opening delimiter
+					pos := Position{Name: l.name, Line: item.Line + 1, Column: item.Column}
+					l.report(pos, RuleUnusedVariable, "%s is declared but the template doesn't use it", item.Value)
+				}
+			}
+		}
+	}
+	for _, name := range sortedKeys(vars.used) {
+		if !declared[name] {
+			l.report(vars.used[name], RuleUndeclaredVariable, "%s is used but not declared in the front matter", name)
+		}
+	}
+}
+
+// lintSize checks the prompt, and the tokens reserved for the answer, against the context window of the model.
+// It renders the data fixture when there is one, otherwise it counts the static text of the template.
+func (l *linter) lintSize(f *File, opts LintOptions, static string, lines int) {
+	model := f.Model
+	if model == "" {
+		model = opts.Model
+	}
+	window := opts.ContextWindow(model)
+	enc, err := tokenizer.ForModel(model)
+	if err != nil {
+		enc = tokenizer.Default()
+	}
+	var tokens int
+	what := "the static text of the template"
+	if opts.Data != nil {
+		_, messages, _, err := f.tmpl.run(f.Name, opts.Data, false)
+		if err != nil {
+			l.reportError(err, lines)
+			return
+		}
+		for _, m := range messages {
+			tokens += enc.Count(m.Content) + messageOverhead
+		}
+		what = "the rendered prompt"
+	} else {
+		tokens = enc.Count(strings.TrimSpace(static))
+	}
+	if window > 0 && tokens+f.MaxTokens > window {
+		pos := Position{Name: l.name, Line: lines + 1, Column: 1}
+		l.report(pos, RuleContextWindow, "%s has %d tokens, with %d reserved for the answer it is over the %d token context window of %s",
+			what, tokens, f.MaxTokens, window, model)
+	}
+}
+
+// scanActions finds the actions of a template source from offset, it expects the source to parse.
+func scanActions(src string, offset int) []action {
+	var actions []action
+	for i := offset; i < len(src); {
+		j := strings.Index(src[i:], "{{")
+		if j < 0 {
+			break
+		}
+		a := action{start: i + j}
+		k := a.start + 2
+		if strings.HasPrefix(src[k:], "- ") {
+			k++
+		}
+		for k < len(src) && isSpaceByte(src[k]) {
+			k++
+		}
+		if strings.HasPrefix(src[k:], "/*") {
+			a.comment = true
+			if e := strings.Index(src[k:], "*/"); e >= 0 {
+				k += e + 2
+			}
+		} else {
+			w := k
+			for w < len(src) && 'a' <= src[w] && src[w] <= 'z' {
+				w++
+			}
+			switch kw := src[k:w]; kw {
+			case "if", "else", "end", "range", "with", "template", "define", "block", "break", "continue":
+				a.keyword = kw
+			}
+		}
+		a.end = actionEnd(src, k)
+		actions = append(actions, a)
+		i = a.end
+	}
+	return actions
+}
+
+// actionEnd returns the offset after the "}}" closing the action at k, skipping quoted strings.
+func actionEnd(src string, k int) int {
+	for k < len(src) {
+		switch c := src[k]; c {
+		case '"', '\'':
+			k++
+			for k < len(src) && src[k] != c {
+				if src[k] == '\\' {
+					k++
+				}
+				k++
+			}
+			k++
+		case '`':
+			if e := strings.IndexByte(src[k+1:], '`'); e >= 0 {
+				k += e + 2
+			} else {
+				return len(src)
+			}
+		case '}':
+			if strings.HasPrefix(src[k:], "}}") {
+				return k + 2
+			}
+			k++
+		default:
+			k++
+		}
+	}
+	return len(src)
+}
@@ -0,0 +1,123 @@
+package prompt_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+	"github.com/yonidavidson/gopherconil.talk/tokenizer"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		opts prompt.LintOptions
+		want []string
+	}{
+		{
+			name: "clean",
+			src:  "<system>Be brief.</system>\n<user>{{.Query}}</user>",
+		},
+		{
+			name: "escaped data isn't a tag",
+			src:  `<user>{{"</user>"}}</user>`,
+		},
+		{
+			name: "unclosed tag",
+			src:  "<system>Be brief.</system>\n<user>{{.Query}}",
+			want: []string{"a.prompt:2:1: unbalanced-tag: unclosed tag <user>"},
+		},
+		{
+			name: "mismatched tag",
+			src:  "<user>hi</assistant>",
+			want: []string{"a.prompt:1:9: unbalanced-tag: mismatched closing tag </assistant> for <user> opened at 1:1"},
+		},
+		{
+			name: "malformed attribute",
+			src:  `<user nme="alice">hi</user>`,
+			want: []string{"a.prompt:1:1: unbalanced-tag: unknown attribute nme in <user>"},
+		},
+		{
+			name: "empty messages",
+			src:  "<system></system>\n<user>{{/* TODO */}}</user>\n<assistant>{{.Answer}}</assistant>",
+			want: []string{
+				"a.prompt:1:1: empty-message: <system> message is empty",
+				"a.prompt:2:1: empty-message: <user> message is empty",
+			},
+		},
+		{
+			name: "system not first",
+			src:  "<user>{{.Query}}</user>\n{{if .Strict}}<system>Be strict.</system>{{end}}",
+			want: []string{"a.prompt:2:15: system-not-first: <system> comes after a user, assistant or tool message"},
+		},
+		{
+			name: "repeated role",
+			src:  "<user>Hi</user>\n<user>{{.Query}}</user>",
+			want: []string{"a.prompt:2:1: repeated-role: <user> follows the <user> message at 1:1, merge them or add the other role between"},
+		},
+		{
+			name: "branches and loops",
+			src: "{{if .Chat}}<user>Hi</user>{{else}}<system>Be brief.</system><user>Hi</user>{{end}}\n" +
+				"{{range .History}}<user>{{.}}</user>{{end}}\n<user name=\"bob\">{{.Query}}</user>",
+		},
+		{
+			name: "stray text",
+			src:  "Answer briefly.\n<user>{{.Query}}</user>",
+			want: []string{`a.prompt:1:1: stray-text: text outside of a message: "Answer briefly."`},
+		},
+		{
+			name: "syntax error",
+			src:  "<user>\n{{.Query</user>",
+			want: []string{"a.prompt:2:1: syntax: bad character U+003C '<'"},
+		},
+		{
+			name: "variables",
+			src:  "---\nrequired: [Query, Extra]\n---\n<user>{{.Query}} {{.Tone}}</user>",
+			want: []string{
+				"a.prompt:2:19: unused-variable: Extra is declared but the template doesn't use it",
+				"a.prompt:4:20: undeclared-variable: Tone is used but not declared in the front matter",
+			},
+		},
+		{
+			name: "context window",
+			src:  "---\nmax_tokens: 8\n---\n<user>{{.Query}}</user>",
+			opts: prompt.LintOptions{
+				Data:          map[string]any{"Query": "What is the capital of France?"},
+				Model:         "gpt-4o",
+				ContextWindow: func(string) int { return 16 },
+			},
+			want: []string{fmt.Sprintf("a.prompt:4:1: context-window: the rendered prompt has %d tokens, with 8 reserved for the answer it is over the 16 token context window of gpt-4o",
+				tokenizer.Default().Count("What is the capital of France?")+4)},
+		},
+		{
+			name: "fixture data",
+			src:  "<user>{{.Query}}</user>",
+			opts: prompt.LintOptions{
+				Data:          map[string]any{"Qurey": "hi"},
+				ContextWindow: func(string) int { return 1000 },
+			},
+			want: []string{"a.prompt:1:1: render: invalid template data: missing variables Query"},
+		},
+		{
+			name: "shared fixture with keys of other templates",
+			src:  "---\nstrict: true\n---\n<user>{{.Query}}</user>",
+			opts: prompt.LintOptions{
+				Data:          map[string]any{"Query": "hi", "SystemPrompt": "be brief"},
+				ContextWindow: func(string) int { return 1000 },
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, d := range prompt.Lint("a.prompt", []byte(tt.src), tt.opts) {
+				got = append(got, d.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package prompt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type (
+	// SyntaxError reports a malformed prompt. Line and Column are positions in the rendered prompt,
+	// Template is the matching position in the template source when it can be traced.
+	SyntaxError struct {
+		Msg      string
+		Line     int
+		Column   int
+		Template *Position
+	}
+
+	// tokenKind is the kind of a token of a rendered prompt
+	tokenKind int
+
+	// contentRange is where the content of a message is in the rendered prompt, before it is unescaped and trimmed,
+	// trim is the number of bytes trimmed from the start of the unescaped content.
+	contentRange struct {
+		start, end int
+		trim       int
+	}
+
+	// token is a piece of a rendered prompt, start and end are byte offsets
+	token struct {
+		kind       tokenKind
+		role       Role
+		start, end int
+		// name, id and calls are the attributes of an opening tag
+		name, id string
+		calls    []ToolCall
+		// err reports a malformed role tag
+		err string
+	}
+)
+
+const (
+	tokenText tokenKind = iota
+	tokenOpen
+	tokenClose
+)
+
+// roles are the roles that have tags in the prompt format.
+var roles = map[Role]bool{
+	RoleSystem:    true,
+	RoleDeveloper: true,
+	RoleUser:      true,
+	RoleAssistant: true,
+	RoleTool:      true,
+}
+
+func (e *SyntaxError) Error() string {
+	msg := fmt.Sprintf("prompt:%d:%d: %s", e.Line, e.Column, e.Msg)
+	if e.Template != nil {
+		msg += fmt.Sprintf(" (template %s)", e.Template)
+	}
+	return msg
+}
+
+// scan splits a rendered prompt into role tags and the text between them.
+// Anything that looks like a tag but isn't a known role tag is text.
+func scan(input string, decode func(string) string) []token {
+	var tokens []token
+	textStart := 0
+	for i := 0; i < len(input); {
+		if input[i] != '<' {
+			i++
+			continue
+		}
+		t, ok := scanTag(input, i, decode)
+		if !ok {
+			i++
+			continue
+		}
+		if textStart < i {
+			tokens = append(tokens, token{kind: tokenText, start: textStart, end: i})
+		}
+		tokens = append(tokens, t)
+		i = t.end
+		textStart = i
+	}
+	if textStart < len(input) {
+		tokens = append(tokens, token{kind: tokenText, start: textStart, end: len(input)})
+	}
+	return tokens
+}
+
+// scanTag reads a role tag at offset i.
+// A known role followed by anything but '>' or whitespace isn't a tag, so <users> is text,
+// but a known role with malformed attributes is a tag with an error.
+func scanTag(input string, i int, decode func(string) string) (token, bool) {
+	t := token{kind: tokenOpen, start: i}
+	j := i + 1
+	if strings.HasPrefix(input[j:], "/") {
+		t.kind = tokenClose
+		j++
+	}
+	k := j
+	for k < len(input) && isNameByte(input[k]) {
+		k++
+	}
+	if k == len(input) || !roles[Role(input[j:k])] || (input[k] != '>' && !isSpaceByte(input[k])) {
+		return token{}, false
+	}
+	t.role = Role(input[j:k])
+	t.end, t.err = scanAttributes(input, k, &t, decode)
+	return t, true
+}
+
+// scanAttributes reads the attributes of tag t from offset k to the closing '>', and returns the end of the tag.
+// decode unescapes the attribute values.
+func scanAttributes(input string, k int, t *token, decode func(string) string) (int, string) {
+	seen := map[string]bool{}
+	for {
+		for k < len(input) && isSpaceByte(input[k]) {
+			k++
+		}
+		if k == len(input) {
+			return k, fmt.Sprintf("unterminated tag <%s", t.role)
+		}
+		if input[k] == '>' {
+			if t.role == RoleTool && t.kind == tokenOpen && t.id == "" {
+				return k + 1, "<tool> needs an id attribute"
+			}
+			return k + 1, ""
+		}
+		if t.kind == tokenClose {
+			return k, fmt.Sprintf("closing tag </%s> can't have attributes", t.role)
+		}
+		start := k
+		for k < len(input) && isNameByte(input[k]) {
+			k++
+		}
+		attr := input[start:k]
+		if attr == "" || !strings.HasPrefix(input[k:], `="`) {
+			return k, fmt.Sprintf("malformed attribute in <%s>, want name=\"value\"", t.role)
+		}
+		end := strings.IndexByte(input[k+2:], '"')
+		if end < 0 {
+			return k, fmt.Sprintf("unterminated value of attribute %s in <%s>", attr, t.role)
+		}
+		value := decode(input[k+2 : k+2+end])
+		k += 2 + end + 1
+		if seen[attr] {
+			return k, fmt.Sprintf("duplicate attribute %s in <%s>", attr, t.role)
+		}
+		seen[attr] = true
+		switch {
+		case attr == "name":
+			t.name = value
+		case attr == "id" && t.role == RoleTool:
+			t.id = value
+		case attr == "tool_calls" && t.role == RoleAssistant:
+			if err := json.Unmarshal([]byte(value), &t.calls); err != nil {
+				return k, fmt.Sprintf("invalid tool_calls in <%s>: %v", t.role, err)
+			}
+		default:
+			return k, fmt.Sprintf("unknown attribute %s in <%s>", attr, t.role)
+		}
+	}
+}
+
+func isNameByte(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_'
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// parseMessages parses a rendered prompt into messages and returns where their content is in the input.
+// Only whitespace may appear between messages, and messages can't be nested.
+// decode unescapes contents and attribute values, unescape for rendered templates and unescaper.Replace for the tagged format.
+// locate maps an offset of the input to the template, it may be nil.
+func parseMessages(input string, decode func(string) string, locate func(offset int) *Position) ([]Message, []contentRange, error) {
+	fail := func(offset int, format string, args ...any) error {
+		line, col := lineColumn(input, offset)
+		err := &SyntaxError{Msg: fmt.Sprintf(format, args...), Line: line, Column: col}
+		if locate != nil {
+			err.Template = locate(offset)
+		}
+		return err
+	}
+
+	var messages []Message
+	var ranges []contentRange
+	var open *token
+	for _, t := range scan(input, decode) {
+		t := t
+		switch t.kind {
+		case tokenText:
+			if open != nil {
+				continue
+			}
+			text := input[t.start:t.end]
+			if i := strings.IndexFunc(text, isText); i >= 0 {
+				return nil, nil, fail(t.start+i, "text outside of a message: %q", excerpt(unescape(text[i:])))
+			}
+		case tokenOpen:
+			if t.err != "" {
+				return nil, nil, fail(t.start, "%s", t.err)
+			}
+			if open != nil {
+				line, col := lineColumn(input, open.start)
+				return nil, nil, fail(t.start, "<%s> nested inside <%s> opened at %d:%d", t.role, open.role, line, col)
+			}
+			open = &t
+		case tokenClose:
+			if t.err != "" {
+				return nil, nil, fail(t.start, "%s", t.err)
+			}
+			if open == nil {
+				return nil, nil, fail(t.start, "closing tag </%s> without an opening tag", t.role)
+			}
+			if t.role != open.role {
+				line, col := lineColumn(input, open.start)
+				return nil, nil, fail(t.start, "mismatched closing tag </%s> for <%s> opened at %d:%d", t.role, open.role, line, col)
+			}
+			// escaped data may start or end with whitespace, so the content is trimmed once it is unescaped
+			content := decode(input[open.end:t.start])
+			trimmed := strings.TrimLeftFunc(content, unicode.IsSpace)
+			messages = append(messages, Message{
+				Role:       open.role,
+				Content:    strings.TrimRightFunc(trimmed, unicode.IsSpace),
+				Name:       open.name,
+				ToolCallID: open.id,
+				ToolCalls:  open.calls,
+			})
+			ranges = append(ranges, contentRange{start: open.end, end: t.start, trim: len(content) - len(trimmed)})
+			open = nil
+		}
+	}
+	if open != nil {
+		return nil, nil, fail(open.start, "unclosed tag <%s>", open.role)
+	}
+	return messages, ranges, nil
+}
+
+// isText reports whether r is text between messages, whitespace and the delimiters of escaped text aren't.
+func isText(r rune) bool {
+	return !unicode.IsSpace(r) && r != escapeStart && r != escapeEnd
+}
+
+// lineColumn returns the 1-based line and byte column of offset in s, counted in the unescaped prompt.
+func lineColumn(s string, offset int) (int, int) {
+	p := Position{Line: 1, Column: 1}.advance(unescape(s[:offset]))
+	return p.Line, p.Column
+}
+
+// excerpt shortens text for error messages.
+func excerpt(text string) string {
+	const maxLen = 20
+	if len(text) <= maxLen {
+		return text
+	}
+	cut := maxLen
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + "…"
+}
@@ -1,17 +1,30 @@
 package prompt
 
 import (
-	"fmt"
-	"regexp"
+	"math"
 	"strings"
 	"text/template"
+
+	"github.com/yonidavidson/gopherconil.talk/tokenizer"
 )
 
 type (
 	// Message represents a message with a role and content.
+	// Name tells participants with the same role apart, ToolCallID is the tool call a tool message answers.
+	// ToolCalls are the tools an assistant message calls, their results follow as tool messages.
 	Message struct {
-		Role    Role
-		Content string
+		Role       Role
+		Content    string
+		Name       string
+		ToolCallID string
+		ToolCalls  []ToolCall
+	}
+
+	// ToolCall is a call of a function tool by the model, Arguments is the JSON object it passes.
+	ToolCall struct {
+		ID        string
+		Name      string
+		Arguments string
 	}
 	// Role represents the role of a message.
 	Role string
@@ -21,84 +34,78 @@ const (
 	RoleSystem    Role = "system"
 	RoleUser      Role = "user"
 	RoleAssistant Role = "assistant"
+	// RoleDeveloper gives instructions to reasoning models, in place of RoleSystem.
+	RoleDeveloper Role = "developer"
+	// RoleTool is the result of a tool call.
+	RoleTool Role = "tool"
 )
 
 // ParseMessages transforms the prompt into a slice of messages.
+// The template output must be a sequence of <system>, <developer>, <user>, <assistant> or <tool> messages
+// separated by whitespace, a malformed prompt returns a *SyntaxError with its position in the output and in the template.
+// Opening tags take a name attribute, <user name="alice">, and tool messages an id attribute, <tool id="call_1">.
+// Assistant messages list their tool calls as a JSON array in the OpenAI format, <assistant tool_calls="{{toJSON .Calls}}">.
+// Data interpolated by the template is escaped so only the template author can write role tags,
+// use {{raw .Field}} for trusted data that holds tagged messages, and Tagged to write messages for it.
+// Only the escapes added to the data are decoded, entities such as &lt; in the template or in raw data are kept.
+// The rendered prompt is returned with the data unescaped, as the messages read it.
+// The data is checked against the fields the template uses first, see ValidationError.
 func ParseMessages(input string, data any) ([]Message, []byte, error) {
-	pt, err := parse(input, data)
+	c, err := compile("talk", input)
 	if err != nil {
 		return nil, nil, err
 	}
-	input = string(pt)
-	// Validate tags before parsing
-	if err := validate(pt); err != nil {
-		return nil, nil, err
-	}
-	var messages []Message
-
-	// Regular expression to match tags and their content
-	re := regexp.MustCompile(`<(system|user|assistant)>([\s\S]*?)</(system|user|assistant)>`)
-
-	// Find all matches in the input string
-	matches := re.FindAllStringSubmatch(input, -1)
-
-	for _, match := range matches {
-		role := Role(match[1])
-		content := strings.TrimSpace(match[2])
-
-		message := Message{
-			Role:    role,
-			Content: content,
-		}
-
-		messages = append(messages, message)
-	}
-
-	return messages, pt, nil
+	return c.render("talk", data)
 }
 
-// validate checks if the input string has matching opening and closing tags for each role.
-func validate(input []byte) error {
-	roles := []string{"system", "user", "assistant"}
-	for _, role := range roles {
-		openCount := strings.Count(string(input), "<"+role+">")
-		closeCount := strings.Count(string(input), "</"+role+">")
-		if openCount != closeCount {
-			return fmt.Errorf("mismatched tags for role %s: %d opening, %d closing", role, openCount, closeCount)
-		}
-	}
-	return nil
-}
-
-func parse(promptTemplate string, data any) ([]byte, error) {
-	tmpl, err := template.New("talk").Funcs(template.FuncMap{
-		"limitTokens": limitTokens,
+// funcMap returns the functions available to prompt templates.
+func funcMap() template.FuncMap {
+	return template.FuncMap{
+		"limitTokens":   limitTokens,
+		"truncate":      truncate,
+		"raw":           raw,
+		"history":       renderHistory,
+		"toJSON":        toJSON,
+		"indent":        indent,
+		"join":          join,
+		"truncateWords": truncateWords,
+		"countTokens":   countTokens,
+		"now":           now,
+		"date":          date,
+		"default":       defaultValue,
+		"bullets":       bullets,
+		"chunks":        chunks,
+		escapeFunc:      escapeValue,
 		"multiply": func(a, b float64) float64 {
 			return a * b
 		},
-	}).Parse(promptTemplate)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing template: %v", err)
 	}
-	var result strings.Builder
-	if err := tmpl.Execute(&result, data); err != nil {
-		return nil, fmt.Errorf("error executing template: %v", err)
-	}
-	return []byte(result.String()), nil
 }
 
+// limitTokens keeps the start of s up to maxTokens tokens, backing up to the last '.', '?' or ','.
 func limitTokens(s string, maxTokens float64) string {
-	const avgTokenLength = 4 // Average token length heuristic
-	maxChars := int(maxTokens * avgTokenLength)
-
-	if len(s) <= maxChars {
+	enc := tokenizer.Default()
+	n := tokenLimit(maxTokens)
+	if enc.Count(s) <= n {
 		return s
 	}
 
-	limited := s[:maxChars]
+	limited := enc.Truncate(s, n)
 	lastStop := strings.LastIndexAny(limited, ".?,")
 	if lastStop != -1 {
 		return limited[:lastStop+1]
 	}
 	return limited
 }
+
+// tokenLimit converts a token limit passed by a template, where numbers are float64, to an int.
+// A negative or NaN limit is 0, and a limit too large for an int doesn't overflow.
+func tokenLimit(maxTokens float64) int {
+	switch {
+	case !(maxTokens > 0):
+		return 0
+	case maxTokens >= math.MaxInt32:
+		return math.MaxInt32
+	}
+	return int(maxTokens)
+}
@@ -1,6 +1,7 @@
 package prompt_test
 
 import (
+	"errors"
 	"reflect"
 	"testing"
 
@@ -67,3 +68,165 @@ func TestParseMessagesError(t *testing.T) {
 		t.Error("Expected an error, but got nil")
 	}
 }
+
+func TestParseMessagesSyntaxError(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		data     any
+		msg      string
+		line     int
+		column   int
+		template string
+	}{
+		{
+			name:     "mismatched closing tag",
+			input:    "<user>Hello</assistant>",
+			msg:      "mismatched closing tag </assistant> for <user> opened at 1:1",
+			line:     1,
+			column:   12,
+			template: "talk:1:12",
+		},
+		{
+			name:     "nested tags",
+			input:    "<user>Hello\n<system>be nice</system></user>",
+			msg:      "<system> nested inside <user> opened at 1:1",
+			line:     2,
+			column:   1,
+			template: "talk:2:1",
+		},
+		{
+			name:     "text outside of messages",
+			input:    "<system>Hi</system>\nstray text\n<user>Hello</user>",
+			msg:      `text outside of a message: "stray text\n"`,
+			line:     2,
+			column:   1,
+			template: "talk:2:1",
+		},
+		{
+			name:     "unclosed tag",
+			input:    "<system>Hi</system>\n  <user>Hello",
+			msg:      "unclosed tag <user>",
+			line:     2,
+			column:   3,
+			template: "talk:2:3",
+		},
+		{
+			name:     "closing tag without opening tag",
+			input:    "</user>",
+			msg:      "closing tag </user> without an opening tag",
+			line:     1,
+			column:   1,
+			template: "talk:1:1",
+		},
+		{
+			name:     "error after multi line data maps back to the template",
+			input:    "<system>{{.System}}</system>\n<user>{{.Query}}</assistant>",
+			data:     map[string]string{"System": "line 1\nline 2\nline 3", "Query": "hi"},
+			msg:      "mismatched closing tag </assistant> for <user> opened at 4:1",
+			line:     4,
+			column:   9,
+			template: "talk:2:17",
+		},
+		{
+			name:     "error inside raw data points at the action",
+			input:    "<user>{{raw .Query}}</user>",
+			data:     map[string]string{"Query": "a </system> b"},
+			msg:      "mismatched closing tag </system> for <user> opened at 1:1",
+			line:     1,
+			column:   9,
+			template: "talk:1:9",
+		},
+		{
+			name:     "tool message without an id",
+			input:    "<user>hi</user>\n<tool>42</tool>",
+			msg:      "<tool> needs an id attribute",
+			line:     2,
+			column:   1,
+			template: "talk:2:1",
+		},
+		{
+			name:     "invalid tool calls",
+			input:    `<assistant tool_calls="[{}]">hi</assistant>`,
+			msg:      `invalid tool_calls in <assistant>: unsupported tool call type ""`,
+			line:     1,
+			column:   1,
+			template: "talk:1:1",
+		},
+		{
+			name:     "unknown attribute",
+			input:    `<user id="1">hi</user>`,
+			msg:      "unknown attribute id in <user>",
+			line:     1,
+			column:   1,
+			template: "talk:1:1",
+		},
+		{
+			name:     "malformed attribute",
+			input:    `<user name=alice>hi</user>`,
+			msg:      `malformed attribute in <user>, want name="value"`,
+			line:     1,
+			column:   1,
+			template: "talk:1:1",
+		},
+		{
+			name:     "attributes on a closing tag",
+			input:    `<user>hi</user name="a">`,
+			msg:      "closing tag </user> can't have attributes",
+			line:     1,
+			column:   9,
+			template: "talk:1:9",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := prompt.ParseMessages(tt.input, tt.data)
+			var se *prompt.SyntaxError
+			if !errors.As(err, &se) {
+				t.Fatalf("expected a *SyntaxError, got %v", err)
+			}
+			if se.Msg != tt.msg || se.Line != tt.line || se.Column != tt.column {
+				t.Errorf("got %q at %d:%d, want %q at %d:%d", se.Msg, se.Line, se.Column, tt.msg, tt.line, tt.column)
+			}
+			if se.Template == nil || se.Template.String() != tt.template {
+				t.Errorf("template position = %v, want %s", se.Template, tt.template)
+			}
+		})
+	}
+}
+
+func TestParseMessagesIgnoresUnknownTags(t *testing.T) {
+	input := "<user>Is <b>bold</b> valid html, and is 1 < 2?</user>"
+	m, _, err := prompt.ParseMessages(input, nil)
+	if err != nil {
+		t.Fatalf("ParseMessages() error = %v", err)
+	}
+	expected := []prompt.Message{{Role: prompt.RoleUser, Content: "Is <b>bold</b> valid html, and is 1 < 2?"}}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("ParseMessages() = %v, want %v", m, expected)
+	}
+}
+
+func TestParseMessagesRolesAndAttributes(t *testing.T) {
+	input := `<developer>Use tools.</developer>
+<user name="alice">What is 6*7?</user>
+<user name="{{.Name}}">{{.Query}}</user>
+<assistant name="bot" tool_calls="{{toJSON .Calls}}">Let me check.</assistant>
+<tool id="call_1">42</tool>`
+	calls := []prompt.ToolCall{{ID: "call_1", Name: "multiply", Arguments: `{"a": 6, "b": 7}`}}
+	data := map[string]any{"Name": `bob" id="x`, "Query": "Same", "Calls": calls}
+	got, _, err := prompt.ParseMessages(input, data)
+	if err != nil {
+		t.Fatalf("ParseMessages() error = %v", err)
+	}
+	expected := []prompt.Message{
+		{Role: prompt.RoleDeveloper, Content: "Use tools."},
+		{Role: prompt.RoleUser, Content: "What is 6*7?", Name: "alice"},
+		{Role: prompt.RoleUser, Content: "Same", Name: `bob" id="x`},
+		{Role: prompt.RoleAssistant, Content: "Let me check.", Name: "bot", ToolCalls: calls},
+		{Role: prompt.RoleTool, Content: "42", ToolCallID: "call_1"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("ParseMessages() = %v, want %v", got, expected)
+	}
+}
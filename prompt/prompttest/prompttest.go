@@ -0,0 +1,93 @@
+// Package prompttest checks rendered prompts against golden files, so templates get regression coverage
+// without calling a model. Run the tests with -update to write the golden files again.
+package prompttest
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+	"github.com/yonidavidson/gopherconil.talk/tokenizer"
+)
+
+var update = flag.Bool("update", false, "update the prompt golden files")
+
+// Dir is where golden files are stored, relative to the package under test.
+const Dir = "testdata"
+
+// Snapshot formats messages for a golden file, with the token count of every message and the total.
+func Snapshot(messages []prompt.Message) string {
+	enc := tokenizer.Default()
+	var sb strings.Builder
+	total := 0
+	for _, m := range messages {
+		tokens := enc.Count(m.Content)
+		total += tokens
+		fmt.Fprintf(&sb, "=== %s", m.Role)
+		if m.Name != "" {
+			fmt.Fprintf(&sb, " name=%q", m.Name)
+		}
+		if m.ToolCallID != "" {
+			fmt.Fprintf(&sb, " id=%q", m.ToolCallID)
+		}
+		fmt.Fprintf(&sb, " (%d tokens)\n%s\n", tokens, m.Content)
+	}
+	fmt.Fprintf(&sb, "--- %d messages, %d tokens (%s)\n", len(messages), total, enc.Name())
+	return sb.String()
+}
+
+// AssertGolden compares the snapshot of messages with the golden file Dir/name.golden.
+func AssertGolden(t testing.TB, name string, messages []prompt.Message) {
+	t.Helper()
+	path := filepath.Join(Dir, name+".golden")
+	got := Snapshot(messages)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("error creating golden directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatalf("error writing golden file: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error reading golden file, run the test with -update to create it: %v", err)
+	}
+	if got != string(want) {
+		t.Errorf("prompt doesn't match %s, run the test with -update if the change is expected\n%s", path, diff(string(want), got))
+	}
+}
+
+// AssertTemplate renders a template with fixture data and compares it with the golden file Dir/name.golden.
+func AssertTemplate(t testing.TB, name, src string, data any) {
+	t.Helper()
+	m, _, err := prompt.ParseMessages(src, data)
+	if err != nil {
+		t.Fatalf("error rendering %s: %v", name, err)
+	}
+	AssertGolden(t, name, m)
+}
+
+// diff lists the lines that differ, it is enough for the short files golden prompts are.
+func diff(want, got string) string {
+	wantLines, gotLines := strings.Split(want, "\n"), strings.Split(got, "\n")
+	var sb strings.Builder
+	for i := 0; i < max(len(wantLines), len(gotLines)); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			fmt.Fprintf(&sb, "line %d:\n- %s\n+ %s\n", i+1, w, g)
+		}
+	}
+	return sb.String()
+}
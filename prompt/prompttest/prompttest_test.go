@@ -0,0 +1,28 @@
+package prompttest_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+	"github.com/yonidavidson/gopherconil.talk/prompt/prompttest"
+)
+
+func TestSnapshot(t *testing.T) {
+	got := prompttest.Snapshot([]prompt.Message{
+		{Role: prompt.RoleUser, Content: "hi", Name: "alice"},
+		{Role: prompt.RoleTool, Content: "42", ToolCallID: "call_1"},
+	})
+	for _, want := range []string{"=== user name=\"alice\" (", "\nhi\n", "=== tool id=\"call_1\" (", "--- 2 messages, "} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Snapshot() = %q, want it to contain %q", got, want)
+		}
+	}
+}
+
+func TestAssertTemplate(t *testing.T) {
+	prompttest.AssertTemplate(t, "example", "<system>{{.System}}</system>\n<user>{{.Query}}</user>", map[string]string{
+		"System": "You are a helpful assistant.",
+		"Query":  "What is the capital of France?",
+	})
+}
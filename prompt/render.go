@@ -0,0 +1,268 @@
+package prompt
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"unicode/utf8"
+)
+
+type (
+	// Position is a location in a template or in a rendered prompt, lines and columns start at 1 and columns count bytes.
+	Position struct {
+		Name   string
+		Line   int
+		Column int
+	}
+
+	// compiled is a parsed template whose nodes are preceded by markers,
+	// so every part of the rendered prompt can be traced back to the template node that produced it.
+	// The output of its actions is escaped, see Escape.
+	compiled struct {
+		tmpl  *template.Template
+		nodes []nodeInfo
+		// vars are the variables of each template, by name
+		vars map[string]*variables
+	}
+
+	// nodeInfo is where an instrumented node comes from.
+	nodeInfo struct {
+		pos  Position
+		node parse.Node
+		// text is set for text nodes, they render verbatim so offsets inside them map to the template byte by byte.
+		text string
+		// action is the pipeline of an action node as written, and fields the data fields it reads, see Span
+		action string
+		fields []string
+	}
+
+	// rendered is the output of a template, without the markers, and the offsets where each node started writing.
+	rendered struct {
+		text  string
+		marks []mark
+	}
+
+	mark struct {
+		offset int
+		node   int
+	}
+)
+
+// markStart and markEnd delimit the node markers, they are Unicode private use characters.
+const (
+	markStart = '\uE000'
+	markEnd   = '\uE001'
+)
+
+// newTemplate returns an empty prompt template with the prompt functions.
+// A missing map key is an error rather than "<no value>".
+func newTemplate(name string) *template.Template {
+	return template.New(name).Funcs(funcMap()).Option("missingkey=error")
+}
+
+// compile parses a single template source.
+func compile(name, src string) (*compiled, error) {
+	t, err := newTemplate(name).Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template: %v", err)
+	}
+	return instrument(t), nil
+}
+
+// instrument adds a marker before every node of t and of the templates associated with it, and escapes their actions.
+// It also infers the variables of each template.
+func instrument(t *template.Template) *compiled {
+	c := &compiled{tmpl: t, vars: map[string]*variables{}}
+	templates := t.Templates()
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name() < templates[j].Name() })
+	for _, tt := range templates {
+		c.vars[tt.Name()] = templateVariables(t, tt.Name())
+	}
+	for _, tt := range templates {
+		if tt.Tree != nil && tt.Tree.Root != nil {
+			c.instrumentList(tt.Tree, tt.Tree.Root, "")
+		}
+	}
+	return c
+}
+
+// instrumentList instruments the nodes of list, dot is the data path of dot in the list, see Span.
+func (c *compiled) instrumentList(tree *parse.Tree, list *parse.ListNode, dot string) {
+	if list == nil {
+		return
+	}
+	nodes := make([]parse.Node, 0, 2*len(list.Nodes))
+	for _, n := range list.Nodes {
+		id := len(c.nodes)
+		info := nodeInfoOf(tree, n)
+		if a, ok := n.(*parse.ActionNode); ok {
+			info.action = a.Pipe.String()
+			info.fields = pipeFields(a.Pipe, dot, nil)
+		}
+		c.nodes = append(c.nodes, info)
+		marker := fmt.Sprintf("%c%d%c", markStart, id, markEnd)
+		nodes = append(nodes, &parse.TextNode{NodeType: parse.NodeText, Pos: n.Position(), Text: []byte(marker)}, n)
+		switch n := n.(type) {
+		case *parse.ActionNode:
+			escapeAction(n)
+		case *parse.IfNode:
+			c.instrumentList(tree, n.List, dot)
+			c.instrumentList(tree, n.ElseList, dot)
+		case *parse.RangeNode:
+			inner := ""
+			if path := fieldPath(n.Pipe, dot); path != "" {
+				inner = path + "[]"
+			}
+			c.instrumentList(tree, n.List, inner)
+			c.instrumentList(tree, n.ElseList, dot)
+		case *parse.WithNode:
+			c.instrumentList(tree, n.List, fieldPath(n.Pipe, dot))
+			c.instrumentList(tree, n.ElseList, dot)
+		}
+	}
+	list.Nodes = nodes
+}
+
+func nodeInfoOf(tree *parse.Tree, n parse.Node) nodeInfo {
+	info := nodeInfo{node: n, pos: nodePosition(tree, n)}
+	if t, ok := n.(*parse.TextNode); ok {
+		info.text = string(t.Text)
+	}
+	return info
+}
+
+// nodePosition returns where n is in the template source of tree.
+func nodePosition(tree *parse.Tree, n parse.Node) Position {
+	// the location has the form name:line:column, with a zero based column
+	location, _ := tree.ErrorContext(n)
+	if i := strings.LastIndex(location, ":"); i > 0 {
+		col, _ := strconv.Atoi(location[i+1:])
+		location = location[:i]
+		if j := strings.LastIndex(location, ":"); j > 0 {
+			line, _ := strconv.Atoi(location[j+1:])
+			return Position{Name: location[:j], Line: line, Column: col + 1}
+		}
+	}
+	return Position{}
+}
+
+// execute renders the named template and strips the markers from its output.
+func (c *compiled) execute(name string, data any) (*rendered, error) {
+	var sb strings.Builder
+	if err := c.tmpl.ExecuteTemplate(&sb, name, data); err != nil {
+		return nil, fmt.Errorf("error executing template: %v", err)
+	}
+	return unmark(sb.String()), nil
+}
+
+// render validates the data, executes the named template and parses its output into messages.
+func (c *compiled) render(name string, data any) ([]Message, []byte, error) {
+	r, messages, _, err := c.run(name, data, c.strict(name))
+	if err != nil {
+		return nil, nil, err
+	}
+	return messages, []byte(unescape(r.text)), nil
+}
+
+// strict reports whether the named template rejects map keys it doesn't use.
+func (c *compiled) strict(name string) bool {
+	vars, ok := c.vars[name]
+	return ok && vars.strict
+}
+
+// run is render, it also returns the output and where the content of each message is in it.
+// With strict, map keys the template doesn't use are validation errors.
+func (c *compiled) run(name string, data any, strict bool) (*rendered, []Message, []contentRange, error) {
+	if vars, ok := c.vars[name]; ok {
+		var err error
+		if data, err = vars.validate(data, strict); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	r, err := c.execute(name, data)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	messages, ranges, err := parseMessages(r.text, unescape, func(offset int) *Position {
+		return c.position(r, offset)
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return r, messages, ranges, nil
+}
+
+// unmark removes the node markers from s and records where they were.
+func unmark(s string) *rendered {
+	r := &rendered{}
+	var sb strings.Builder
+	sb.Grow(len(s))
+	startLen, endLen := utf8.RuneLen(markStart), utf8.RuneLen(markEnd)
+	for {
+		i := strings.IndexRune(s, markStart)
+		if i < 0 {
+			break
+		}
+		j := strings.IndexRune(s[i+startLen:], markEnd)
+		id, err := strconv.Atoi(s[i+startLen : i+startLen+max(j, 0)])
+		if j < 0 || err != nil {
+			// not a marker, keep the character
+			sb.WriteString(s[:i+startLen])
+			s = s[i+startLen:]
+			continue
+		}
+		sb.WriteString(s[:i])
+		r.marks = append(r.marks, mark{offset: sb.Len(), node: id})
+		s = s[i+startLen+j+endLen:]
+	}
+	sb.WriteString(s)
+	r.text = sb.String()
+	return r
+}
+
+// source returns the mark that produced the byte at offset of the rendered text.
+func (r *rendered) source(offset int) (mark, bool) {
+	// several nodes can start at the same offset when the first ones render nothing, the last one wins
+	k := sort.Search(len(r.marks), func(i int) bool { return r.marks[i].offset > offset }) - 1
+	if k < 0 {
+		return mark{}, false
+	}
+	return r.marks[k], true
+}
+
+// position maps an offset of the rendered text to the template, it returns nil when the offset can't be traced.
+func (c *compiled) position(r *rendered, offset int) *Position {
+	m, ok := r.source(offset)
+	if !ok || m.node >= len(c.nodes) {
+		return nil
+	}
+	info := c.nodes[m.node]
+	pos := info.pos
+	if delta := offset - m.offset; info.text != "" && delta <= len(info.text) {
+		pos = pos.advance(info.text[:delta])
+	}
+	return &pos
+}
+
+// advance returns the position after s.
+func (p Position) advance(s string) Position {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\n' {
+			p.Line++
+			p.Column = 1
+		} else {
+			p.Column++
+		}
+	}
+	return p
+}
+
+func (p Position) String() string {
+	if p.Name == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.Name, p.Line, p.Column)
+}
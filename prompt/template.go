@@ -0,0 +1,239 @@
+package prompt
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+type (
+	// Template is a prompt template compiled once for data of type T.
+	// NewTemplate checks that every field the template references exists on T, in the bodies of {{range}} and {{with}}
+	// against the element or value type, so a misspelled field fails when the template is created rather than when it is rendered.
+	Template[T any] struct {
+		name string
+		c    *compiled
+	}
+
+	// typed is the type of dot or $ in a part of a template, a nil typ can't be checked.
+	// path names it in errors, such as Items[] in the body of {{range .Items}}.
+	typed struct {
+		typ  reflect.Type
+		path string
+	}
+
+	// typeChecker checks the fields a template references against the type of its data,
+	// following dot into the bodies of {{range}} and {{with}} and into the templates it includes.
+	typeChecker struct {
+		tmpl     *template.Template
+		funcs    template.FuncMap
+		problems []string
+		seen     map[string]bool
+		visited  map[string]bool
+	}
+)
+
+// NewTemplate compiles src for data of type T, a struct, a pointer to a struct or a map with string keys.
+func NewTemplate[T any](name, src string) (*Template[T], error) {
+	c, err := compile(name, src)
+	if err != nil {
+		return nil, err
+	}
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	tc := &typeChecker{tmpl: c.tmpl, funcs: funcMap(), seen: map[string]bool{}, visited: map[string]bool{}}
+	tc.template(name, typed{typ: typ})
+	if len(tc.problems) > 0 {
+		return nil, fmt.Errorf("template %s doesn't match %v: %s", name, typ, strings.Join(tc.problems, ", "))
+	}
+	return &Template[T]{name: name, c: c}, nil
+}
+
+// Render executes the template and parses its output into messages, like ParseMessages.
+func (t *Template[T]) Render(data T) ([]Message, []byte, error) {
+	return t.c.render(t.name, data)
+}
+
+func (tc *typeChecker) template(name string, dot typed) {
+	key := name
+	if dot.typ != nil {
+		key += " " + dot.typ.String()
+	}
+	if tc.visited[key] {
+		return
+	}
+	tc.visited[key] = true
+	if t := tc.tmpl.Lookup(name); t != nil && t.Tree != nil {
+		// $ is the data the template is executed with
+		tc.list(t.Tree.Root, dot, dot)
+	}
+}
+
+func (tc *typeChecker) list(l *parse.ListNode, dot, dollar typed) {
+	if l == nil {
+		return
+	}
+	for _, n := range l.Nodes {
+		tc.node(n, dot, dollar)
+	}
+}
+
+func (tc *typeChecker) node(n parse.Node, dot, dollar typed) {
+	switch n := n.(type) {
+	case *parse.ActionNode:
+		tc.pipe(n.Pipe, dot, dollar)
+	case *parse.IfNode:
+		tc.pipe(n.Pipe, dot, dollar)
+		tc.list(n.List, dot, dollar)
+		tc.list(n.ElseList, dot, dollar)
+	case *parse.WithNode:
+		tc.list(n.List, tc.pipe(n.Pipe, dot, dollar), dollar)
+		tc.list(n.ElseList, dot, dollar)
+	case *parse.RangeNode:
+		tc.list(n.List, element(tc.pipe(n.Pipe, dot, dollar)), dollar)
+		tc.list(n.ElseList, dot, dollar)
+	case *parse.TemplateNode:
+		if n.Pipe == nil {
+			tc.template(n.Name, typed{})
+			return
+		}
+		tc.template(n.Name, tc.pipe(n.Pipe, dot, dollar))
+	}
+}
+
+// pipe checks the fields of a pipeline and returns the type of its value.
+func (tc *typeChecker) pipe(p *parse.PipeNode, dot, dollar typed) typed {
+	if p == nil {
+		return typed{}
+	}
+	var t typed
+	for _, c := range p.Cmds {
+		for _, arg := range c.Args[1:] {
+			tc.arg(arg, dot, dollar)
+		}
+		t = tc.arg(c.Args[0], dot, dollar)
+		if _, ok := c.Args[0].(*parse.IdentifierNode); ok && t.typ != nil {
+			// the value of a function call is named by the call
+			t.path = "(" + c.String() + ")"
+		}
+	}
+	return t
+}
+
+// arg checks the fields of an argument or command and returns the type of its value.
+func (tc *typeChecker) arg(n parse.Node, dot, dollar typed) typed {
+	switch n := n.(type) {
+	case *parse.DotNode:
+		return dot
+	case *parse.FieldNode:
+		return tc.field(dot, n.Ident)
+	case *parse.VariableNode:
+		// other variables are declared by the template, their type isn't tracked
+		if n.Ident[0] == "$" {
+			return tc.field(dollar, n.Ident[1:])
+		}
+	case *parse.ChainNode:
+		return tc.field(tc.arg(n.Node, dot, dollar), n.Field)
+	case *parse.PipeNode:
+		return tc.pipe(n, dot, dollar)
+	case *parse.IdentifierNode:
+		// builtins such as index aren't in the function map and aren't typed
+		if fn, ok := tc.funcs[n.Ident]; ok {
+			if ft := reflect.TypeOf(fn); ft.NumOut() > 0 {
+				return typed{typ: ft.Out(0)}
+			}
+		}
+	}
+	return typed{}
+}
+
+// field checks a chain of fields such as Budgets.Tokens on t and returns the type of its value.
+// Interfaces and maps with values of interface type can hold anything, so they aren't checked.
+func (tc *typeChecker) field(t typed, path []string) typed {
+	if t.typ == nil || len(path) == 0 {
+		return t
+	}
+	name := func(i int) string {
+		if t.path == "" {
+			return strings.Join(path[:i], ".")
+		}
+		return strings.Join(append([]string{t.path}, path[:i]...), ".")
+	}
+	typ := t.typ
+	for i, f := range path {
+		if m, ok := method(typ, f); ok {
+			if m.Type.NumOut() == 0 {
+				tc.report(name(i+1), fmt.Sprintf("method %s returns nothing", name(i+1)))
+				return typed{}
+			}
+			typ = m.Type.Out(0)
+			continue
+		}
+		for typ.Kind() == reflect.Pointer {
+			typ = typ.Elem()
+		}
+		switch typ.Kind() {
+		case reflect.Struct:
+			sf, ok := typ.FieldByName(f)
+			if !ok || !sf.IsExported() {
+				tc.report(name(i+1), fmt.Sprintf("no field or method %s", name(i+1)))
+				return typed{}
+			}
+			typ = sf.Type
+		case reflect.Map:
+			if typ.Key().Kind() != reflect.String {
+				tc.report(name(i+1), fmt.Sprintf("%s is a map without string keys", name(i)))
+				return typed{}
+			}
+			typ = typ.Elem()
+		case reflect.Interface:
+			return typed{}
+		default:
+			tc.report(name(i+1), fmt.Sprintf("%s of type %v has no field %s", name(i), typ, f))
+			return typed{}
+		}
+	}
+	return typed{typ: typ, path: name(len(path))}
+}
+
+// report adds a problem once per field path.
+func (tc *typeChecker) report(path, problem string) {
+	if !tc.seen[path] {
+		tc.seen[path] = true
+		tc.problems = append(tc.problems, problem)
+	}
+}
+
+// element returns the type of dot in the body of {{range}} over a value of type t.
+func element(t typed) typed {
+	typ := t.typ
+	for typ != nil && typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ == nil {
+		return typed{}
+	}
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Chan:
+		return typed{typ: typ.Elem(), path: t.path + "[]"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return typed{typ: typ, path: t.path + "[]"}
+	}
+	return typed{}
+}
+
+// method looks name up among the methods of typ and of a pointer to typ, text/template can call both.
+func method(typ reflect.Type, name string) (reflect.Method, bool) {
+	if typ.Kind() == reflect.Interface {
+		return typ.MethodByName(name)
+	}
+	if m, ok := typ.MethodByName(name); ok {
+		return m, true
+	}
+	if typ.Kind() != reflect.Pointer {
+		return reflect.PointerTo(typ).MethodByName(name)
+	}
+	return reflect.Method{}, false
+}
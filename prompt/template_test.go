@@ -0,0 +1,106 @@
+package prompt_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+)
+
+type (
+	ragData struct {
+		Budgets    prompt.Budgets
+		RAGContext string
+		UserQuery  string
+		Meta       *meta
+		Extra      map[string]string
+		Any        any
+		Docs       []meta
+		Pages      [2]*meta
+		ByName     map[string]meta
+		Stream     chan meta
+	}
+
+	meta struct {
+		Source string
+		Tags   []string
+	}
+)
+
+func (d ragData) Upper() string { return strings.ToUpper(d.UserQuery) }
+
+func TestNewTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		wantErr string
+	}{
+		{name: "fields", src: `<user>{{.UserQuery}} {{.Upper}}</user>`},
+		{name: "methods with arguments", src: `<user>{{limitTokens .RAGContext (.Budgets.Tokens "context")}}</user>`},
+		{name: "nested fields", src: `<user>{{.Meta.Source}} {{.Extra.key}} {{.Any.Whatever}}</user>`},
+		{name: "root variable in range", src: `<user>{{range .Extra}}{{$.UserQuery}}{{end}}</user>`},
+		{name: "range and with bodies", src: `<user>{{range .Docs}}{{.Source}}{{range .Tags}}{{.}}{{end}}{{end}}{{with .Meta}}{{.Source}}{{$.UserQuery}}{{end}}</user>`},
+		{name: "range over arrays, maps and channels", src: `<user>{{range .Pages}}{{.Source}}{{end}}{{range .ByName}}{{.Source}}{{end}}{{range .Stream}}{{.Source}}{{end}}</user>`},
+		{name: "untyped bodies", src: `<user>{{range .Any}}{{.Whatever}}{{end}}{{with index .Docs 0}}{{.Whatever}}{{end}}{{range $i, $d := .Docs}}{{$d.Whatever}}{{end}}</user>`},
+		{
+			name:    "misspelled field in a range body",
+			src:     `<user>{{range .Docs}}{{.Sorce}}{{end}}{{range .Pages}}{{.Sorce}}{{end}}{{range .ByName}}{{.Tags.Len}}{{end}}</user>`,
+			wantErr: "no field or method Docs[].Sorce, no field or method Pages[].Sorce, ByName[].Tags of type []string has no field Len",
+		},
+		{
+			name:    "misspelled field in a with body",
+			src:     `<user>{{with .Meta}}{{.Bogus}}{{end}}{{with .Docs}}{{range .}}{{.Bogus}}{{end}}{{end}}</user>`,
+			wantErr: "no field or method Meta.Bogus, no field or method Docs[].Bogus",
+		},
+		{
+			name:    "field of a function result",
+			src:     `<user>{{with toJSON .Docs}}{{.Bogus}}{{end}}</user>`,
+			wantErr: `(toJSON .Docs) of type string has no field Bogus`,
+		},
+		{
+			name:    "misspelled fields are all reported",
+			src:     `<user>{{.RagContext}} {{.Meta.Sorce}} {{if .UserQuery.Len}}{{end}}</user>`,
+			wantErr: "no field or method RagContext, no field or method Meta.Sorce, UserQuery of type string has no field Len",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := prompt.NewTemplate[ragData]("rag", tt.src)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("NewTemplate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasSuffix(err.Error(), tt.wantErr) {
+				t.Errorf("NewTemplate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTemplateRender(t *testing.T) {
+	tmpl, err := prompt.NewTemplate[*ragData]("rag", `<system>{{.Upper}}</system><user>{{.UserQuery}}</user>`)
+	if err != nil {
+		t.Fatalf("NewTemplate() error = %v", err)
+	}
+	for _, q := range []string{"one", "two"} {
+		m, _, err := tmpl.Render(&ragData{UserQuery: q})
+		if err != nil {
+			t.Fatalf("Render() error = %v", err)
+		}
+		want := []prompt.Message{{Role: prompt.RoleSystem, Content: strings.ToUpper(q)}, {Role: prompt.RoleUser, Content: q}}
+		if !reflect.DeepEqual(m, want) {
+			t.Errorf("Render() = %v, want %v", m, want)
+		}
+	}
+
+	maps, err := prompt.NewTemplate[map[string]string]("map", `<user>{{.UserQuery}}</user>`)
+	if err != nil {
+		t.Fatalf("NewTemplate() error = %v", err)
+	}
+	if _, _, err := maps.Render(map[string]string{}); err == nil {
+		t.Error("expected an error for a missing key")
+	}
+}
@@ -0,0 +1,205 @@
+package prompt
+
+import (
+	"fmt"
+	"strings"
+	"text/template/parse"
+)
+
+type (
+	// Span is a part of the content of a message and the template node that wrote it.
+	Span struct {
+		// Start and End are byte offsets in Message.Content.
+		Start, End int
+		// Template is where the text starts in the template, or where the pipeline of the action that printed it starts.
+		Template Position
+		// Action is the pipeline of the action that printed the text, such as limitTokens .RAGContext 100,
+		// it is empty for template text.
+		Action string
+		// Fields are the data fields the action reads, such as .RAGContext.
+		// Inside {{range}} and {{with}} over a field they start with that field, as in .Items[].Name,
+		// elsewhere they are relative to dot.
+		Fields []string
+	}
+
+	// SourceMap is a rendered prompt with the spans of the content of each message.
+	// Its String method renders the annotated prompt.
+	SourceMap struct {
+		Messages []Message
+		// Spans are the spans of each message, in order and covering its content
+		Spans [][]Span
+	}
+)
+
+// TraceMessages is ParseMessages for debugging, it also maps the content of every message back to the template.
+func TraceMessages(input string, data any) (*SourceMap, error) {
+	c, err := compile("talk", input)
+	if err != nil {
+		return nil, err
+	}
+	return c.trace("talk", data)
+}
+
+// Trace renders the template like Render and maps the content of every message back to the template.
+func (t *Template[T]) Trace(data T) (*SourceMap, error) {
+	return t.c.trace(t.name, data)
+}
+
+// Trace renders the file like Render and maps the content of every message back to the template.
+func (f *File) Trace(data any) (*SourceMap, error) {
+	return f.tmpl.trace(f.Name, data)
+}
+
+func (c *compiled) trace(name string, data any) (*SourceMap, error) {
+	r, messages, ranges, err := c.run(name, data, c.strict(name))
+	if err != nil {
+		return nil, err
+	}
+	m := &SourceMap{Messages: messages, Spans: make([][]Span, len(messages))}
+	for i, cr := range ranges {
+		m.Spans[i] = c.spans(r, cr, len(messages[i].Content))
+	}
+	return m, nil
+}
+
+// spans splits the content range of a message at the node markers, n is the length of the content.
+func (c *compiled) spans(r *rendered, cr contentRange, n int) []Span {
+	_, offsets := unescapeOffsets(r.text[cr.start:cr.end])
+	// offset maps an offset of the rendered prompt to an offset of the trimmed content
+	offset := func(i int) int {
+		return min(max(offsets[i-cr.start]-cr.trim, 0), n)
+	}
+	// first is where the trimmed content starts, the template position of the first span is taken there
+	first := cr.start
+	for first < cr.end && offsets[first-cr.start] < cr.trim {
+		first++
+	}
+	var spans []Span
+	k := -1
+	for start := cr.start; start < cr.end; {
+		// several nodes can start at the same offset when the first ones render nothing, the last one wins
+		for k+1 < len(r.marks) && r.marks[k+1].offset <= start {
+			k++
+		}
+		end := cr.end
+		if k+1 < len(r.marks) && r.marks[k+1].offset < end {
+			end = r.marks[k+1].offset
+		}
+		s := Span{Start: offset(start), End: offset(end)}
+		if pos := c.position(r, max(start, first)); pos != nil {
+			s.Template = *pos
+		}
+		if k >= 0 && r.marks[k].node < len(c.nodes) {
+			info := c.nodes[r.marks[k].node]
+			s.Action, s.Fields = info.action, info.fields
+		}
+		if s.End > s.Start {
+			spans = append(spans, s)
+		}
+		start = end
+	}
+	return spans
+}
+
+// String renders the messages with the origin of every span in a margin:
+//
+//	=== user
+//	rag:3:1                 | Context:
+//	rag:4:3 {{.RAGContext}} | Go is a programming language.
+func (m *SourceMap) String() string {
+	type row struct{ label, text string }
+	var rows [][]row
+	width := 0
+	for i, msg := range m.Messages {
+		var rs []row
+		for _, s := range m.Spans[i] {
+			label := s.Template.String()
+			if s.Action != "" {
+				label += " {{" + s.Action + "}}"
+			}
+			width = max(width, len(label))
+			lines := strings.Split(strings.TrimSuffix(msg.Content[s.Start:s.End], "\n"), "\n")
+			for j, line := range lines {
+				if j > 0 {
+					label = ""
+				}
+				rs = append(rs, row{label: label, text: line})
+			}
+		}
+		rows = append(rows, rs)
+	}
+	var sb strings.Builder
+	for i, msg := range m.Messages {
+		fmt.Fprintf(&sb, "=== %s", msg.Role)
+		if msg.Name != "" {
+			fmt.Fprintf(&sb, " name=%q", msg.Name)
+		}
+		if msg.ToolCallID != "" {
+			fmt.Fprintf(&sb, " id=%q", msg.ToolCallID)
+		}
+		sb.WriteByte('\n')
+		for _, r := range rows[i] {
+			fmt.Fprintf(&sb, "%-*s | %s\n", width, r.label, r.text)
+		}
+	}
+	return sb.String()
+}
+
+// pipeFields appends the data fields read by a pipeline to fields, dot is the data path of dot.
+func pipeFields(p *parse.PipeNode, dot string, fields []string) []string {
+	if p == nil {
+		return fields
+	}
+	for _, cmd := range p.Cmds {
+		for _, arg := range cmd.Args {
+			fields = argFields(arg, dot, fields)
+		}
+	}
+	return fields
+}
+
+func argFields(n parse.Node, dot string, fields []string) []string {
+	add := func(path string) []string {
+		for _, f := range fields {
+			if f == path {
+				return fields
+			}
+		}
+		return append(fields, path)
+	}
+	switch n := n.(type) {
+	case *parse.FieldNode:
+		return add(dot + n.String())
+	case *parse.DotNode:
+		if dot == "" {
+			return add(".")
+		}
+		return add(dot)
+	case *parse.VariableNode:
+		// $ is the template data whatever dot is
+		if n.Ident[0] == "$" {
+			return add("." + strings.Join(n.Ident[1:], "."))
+		}
+	case *parse.ChainNode:
+		return argFields(n.Node, dot, fields)
+	case *parse.PipeNode:
+		return pipeFields(n, dot, fields)
+	}
+	return fields
+}
+
+// fieldPath returns the data path of a pipeline that is a single field, such as the pipeline of {{range .Items}},
+// or "" when it is anything else.
+func fieldPath(p *parse.PipeNode, dot string) string {
+	if p == nil || len(p.Cmds) != 1 || len(p.Cmds[0].Args) != 1 {
+		return ""
+	}
+	switch p.Cmds[0].Args[0].(type) {
+	case *parse.FieldNode, *parse.DotNode, *parse.VariableNode:
+		// the data itself has no path
+		if fields := pipeFields(p, dot, nil); len(fields) == 1 && fields[0] != "." {
+			return fields[0]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,103 @@
+package prompt_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+)
+
+func TestTraceMessages(t *testing.T) {
+	const src = `<system>Be brief.</system>
+<user>
+Context: {{limitTokens .Context 100}}
+{{range .Items}}- {{.Name}}
+{{end}}{{with .User}}Asked by {{.Name}}{{end}}
+</user>`
+	data := map[string]any{
+		"Context": `<b>bold</b> & "quoted"`,
+		"Items":   []map[string]any{{"Name": "one"}, {"Name": "two"}},
+		"User":    map[string]any{"Name": "alice"},
+	}
+	m, err := prompt.TraceMessages(src, data)
+	if err != nil {
+		t.Fatalf("error tracing: %v", err)
+	}
+	want, _, err := prompt.ParseMessages(src, data)
+	if err != nil {
+		t.Fatalf("error parsing: %v", err)
+	}
+	if !reflect.DeepEqual(m.Messages, want) {
+		t.Fatalf("messages = %q, want %q", m.Messages, want)
+	}
+	type span struct {
+		text, pos, action string
+		fields            []string
+	}
+	var got [][]span
+	for i, spans := range m.Spans {
+		var ss []span
+		end := 0
+		for _, s := range spans {
+			if s.Start != end {
+				t.Errorf("span %+v of message %d doesn't start where the previous one ended", s, i)
+			}
+			end = s.End
+			ss = append(ss, span{m.Messages[i].Content[s.Start:s.End], s.Template.String(), s.Action, s.Fields})
+		}
+		if end != len(m.Messages[i].Content) {
+			t.Errorf("spans of message %d end at %d, want %d", i, end, len(m.Messages[i].Content))
+		}
+		got = append(got, ss)
+	}
+	wantSpans := [][]span{
+		{{"Be brief.", "talk:1:9", "", nil}},
+		{
+			{"Context: ", "talk:3:1", "", nil},
+			{`<b>bold</b> & "quoted"`, "talk:3:12", "limitTokens .Context 100", []string{".Context"}},
+			{"\n", "talk:3:38", "", nil},
+			{"- ", "talk:4:17", "", nil},
+			{"one", "talk:4:21", ".Name", []string{".Items[].Name"}},
+			{"\n", "talk:4:28", "", nil},
+			{"- ", "talk:4:17", "", nil},
+			{"two", "talk:4:21", ".Name", []string{".Items[].Name"}},
+			{"\n", "talk:4:28", "", nil},
+			{"Asked by ", "talk:5:22", "", nil},
+			{"alice", "talk:5:33", ".Name", []string{".User.Name"}},
+		},
+	}
+	if !reflect.DeepEqual(got, wantSpans) {
+		t.Errorf("spans = %q, want %q", got, wantSpans)
+	}
+}
+
+func TestSourceMapString(t *testing.T) {
+	m, err := prompt.TraceMessages("<system>Be brief.</system>\n<user>Context:\n{{.Context}}</user>", map[string]any{"Context": "Go is fun.\nIt compiles fast."})
+	if err != nil {
+		t.Fatalf("error tracing: %v", err)
+	}
+	want := `=== system
+talk:1:9              | Be brief.
+=== user
+talk:2:7              | Context:
+talk:3:3 {{.Context}} | Go is fun.
+                      | It compiles fast.
+`
+	if got := m.String(); got != want {
+		t.Errorf("String() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFileTrace(t *testing.T) {
+	f, err := prompt.ParseFile("qa", []byte("---\nmodel: gpt-4o\n---\n<user>{{.Query}}</user>\n"))
+	if err != nil {
+		t.Fatalf("error parsing file: %v", err)
+	}
+	m, err := f.Trace(map[string]any{"Query": "Why?"})
+	if err != nil {
+		t.Fatalf("error tracing: %v", err)
+	}
+	if len(m.Spans) != 1 || len(m.Spans[0]) != 1 || m.Spans[0][0].Template.String() != "qa:4:9" {
+		t.Errorf("unexpected spans %+v", m.Spans)
+	}
+}
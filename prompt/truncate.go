@@ -0,0 +1,179 @@
+package prompt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yonidavidson/gopherconil.talk/tokenizer"
+)
+
+// Strategy selects which part of a text Truncate keeps.
+type Strategy string
+
+const (
+	// TruncateHead keeps the start of the text.
+	TruncateHead Strategy = "head"
+	// TruncateTail keeps the end of the text, such as the latest turns of a chat history.
+	TruncateTail Strategy = "tail"
+	// TruncateMiddle keeps the start and the end of the text with Ellipsis in between, such as for logs.
+	TruncateMiddle Strategy = "middle"
+	// TruncateSentences keeps whole sentences from the start of the text.
+	TruncateSentences Strategy = "sentences"
+	// TruncateLastSentences keeps whole sentences from the end of the text.
+	TruncateLastSentences Strategy = "last-sentences"
+)
+
+// Ellipsis marks the content removed by TruncateMiddle.
+const Ellipsis = "\n[…]\n"
+
+var (
+	// abbreviations are words that end with a period without ending a sentence, compared in lower case.
+	abbreviations = map[string]bool{
+		"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "sr": true, "jr": true, "st": true,
+		"vs": true, "etc": true, "e.g": true, "i.e": true, "cf": true, "al": true, "inc": true, "ltd": true,
+		"co": true, "corp": true, "no": true, "fig": true, "approx": true, "dept": true, "est": true,
+		"jan": true, "feb": true, "mar": true, "apr": true, "jun": true, "jul": true, "aug": true,
+		"sep": true, "sept": true, "oct": true, "nov": true, "dec": true, "u.s": true, "u.k": true,
+	}
+	// terminators end a sentence when followed by whitespace.
+	terminators = map[rune]bool{
+		'.': true, '!': true, '?': true, '…': true,
+		'؟': true, '۔': true, // Arabic and Urdu
+		'।': true, '॥': true, // Devanagari
+		'׃': true,            // Hebrew
+		'։': true,            // Armenian
+		'።': true, '፧': true, // Ethiopic
+	}
+	// fullStops end a sentence even when the next sentence follows without a space, as in Chinese and Japanese.
+	fullStops = map[rune]bool{'。': true, '！': true, '？': true, '．': true, '｡': true}
+	// closers may follow a terminator and still belong to the sentence.
+	closers = "\"'”’)]}»」』）"
+)
+
+// Truncate shortens text to at most maxTokens tokens using the given strategy.
+func Truncate(text string, maxTokens int, s Strategy) (string, error) {
+	enc := tokenizer.Default()
+	if enc.Count(text) <= maxTokens {
+		return text, nil
+	}
+	switch s {
+	case TruncateHead:
+		return enc.Truncate(text, maxTokens), nil
+	case TruncateTail:
+		return enc.TruncateStart(text, maxTokens), nil
+	case TruncateMiddle:
+		return truncateMiddle(enc, text, maxTokens), nil
+	case TruncateSentences, TruncateLastSentences:
+		return truncateSentences(enc, text, maxTokens, s == TruncateLastSentences), nil
+	}
+	return "", fmt.Errorf("unknown truncation strategy %q", s)
+}
+
+// truncate is the template form of Truncate: {{truncate "tail" 200 .ChatHistory}}.
+func truncate(s string, maxTokens float64, text string) (string, error) {
+	return Truncate(text, tokenLimit(maxTokens), Strategy(s))
+}
+
+func truncateMiddle(enc *tokenizer.Encoding, text string, maxTokens int) string {
+	budget := maxTokens - enc.Count(Ellipsis)
+	if budget <= 1 {
+		return enc.Truncate(text, maxTokens)
+	}
+	for ; budget > 1; budget-- {
+		head := enc.Truncate(text, budget-budget/2)
+		tail := enc.TruncateStart(text, budget/2)
+		if s := head + Ellipsis + tail; enc.Count(s) <= maxTokens {
+			return s
+		}
+	}
+	return enc.Truncate(text, maxTokens)
+}
+
+// truncateSentences keeps as many whole sentences as fit from the start, or from the end when fromEnd is set.
+// If not even one sentence fits it falls back to cutting that sentence.
+func truncateSentences(enc *tokenizer.Encoding, text string, maxTokens int, fromEnd bool) string {
+	sentences := Sentences(text)
+	join := func(k int) string {
+		if fromEnd {
+			return strings.TrimSpace(strings.Join(sentences[len(sentences)-k:], ""))
+		}
+		return strings.TrimSpace(strings.Join(sentences[:k], ""))
+	}
+	// the number of tokens grows with the number of sentences, find the largest k that fits
+	k := sort.Search(len(sentences)+1, func(k int) bool { return enc.Count(join(k)) > maxTokens }) - 1
+	if k > 0 {
+		return join(k)
+	}
+	if fromEnd {
+		return enc.TruncateStart(strings.TrimSpace(sentences[len(sentences)-1]), maxTokens)
+	}
+	return enc.Truncate(strings.TrimSpace(sentences[0]), maxTokens)
+}
+
+// Sentences splits text into sentences, each one keeps its trailing whitespace so joining them gives back text.
+// It handles common abbreviations, initials and decimals, and non-Latin punctuation such as 。, ؟ and ।.
+func Sentences(text string) []string {
+	var sentences []string
+	start := 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+		if !terminators[r] && !fullStops[r] {
+			continue
+		}
+		// absorb repeated terminators ("?!", "...") and closing quotes or brackets
+		for i < len(text) {
+			next, size := utf8.DecodeRuneInString(text[i:])
+			if !terminators[next] && !fullStops[next] && !strings.ContainsRune(closers, next) {
+				break
+			}
+			i += size
+		}
+		end := i
+		// the whitespace that follows belongs to the sentence
+		for i < len(text) {
+			next, size := utf8.DecodeRuneInString(text[i:])
+			if !unicode.IsSpace(next) {
+				break
+			}
+			i += size
+		}
+		if i == end && i < len(text) && !fullStops[r] {
+			continue
+		}
+		if r == '.' && !endsSentence(text[start:end], text[i:]) {
+			continue
+		}
+		sentences = append(sentences, text[start:i])
+		start = i
+	}
+	if start < len(text) {
+		sentences = append(sentences, text[start:])
+	}
+	return sentences
+}
+
+// endsSentence reports whether a period ending sentence really ends it, given the text that follows it.
+func endsSentence(sentence, rest string) bool {
+	word := strings.TrimRight(sentence, closers)
+	word = strings.TrimSuffix(word, ".")
+	if i := strings.LastIndexFunc(word, unicode.IsSpace); i >= 0 {
+		word = word[i+1:]
+	}
+	word = strings.TrimLeft(word, "\"'“‘([{«")
+	if abbreviations[strings.ToLower(word)] {
+		return false
+	}
+	// initials such as "J. R. R. Tolkien"
+	if r, size := utf8.DecodeRuneInString(word); size == len(word) && unicode.IsUpper(r) {
+		return false
+	}
+	// a sentence doesn't start with a lower case letter
+	if r, _ := utf8.DecodeRuneInString(rest); unicode.IsLower(r) {
+		return false
+	}
+	return true
+}
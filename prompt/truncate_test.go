@@ -0,0 +1,105 @@
+package prompt_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+	"github.com/yonidavidson/gopherconil.talk/tokenizer"
+)
+
+func TestSentences(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			name:     "simple",
+			input:    "Hello there. How are you? Fine!",
+			expected: []string{"Hello there. ", "How are you? ", "Fine!"},
+		},
+		{
+			name:     "abbreviations and initials",
+			input:    "Dr. Smith met J. R. R. Tolkien, e.g. at 3.5 p.m. in the U.S. office. They talked.",
+			expected: []string{"Dr. Smith met J. R. R. Tolkien, e.g. at 3.5 p.m. in the U.S. office. ", "They talked."},
+		},
+		{
+			name:     "quotes and repeated punctuation",
+			input:    "He said \"stop!\" Then he left?! Nobody knew...",
+			expected: []string{"He said \"stop!\" ", "Then he left?! ", "Nobody knew..."},
+		},
+		{
+			name:     "chinese",
+			input:    "你好。今天天气很好！我们走吧？",
+			expected: []string{"你好。", "今天天气很好！", "我们走吧？"},
+		},
+		{
+			name:     "arabic and hindi",
+			input:    "كيف حالك؟ أنا بخير. यह अच्छा है। धन्यवाद।",
+			expected: []string{"كيف حالك؟ ", "أنا بخير. ", "यह अच्छा है। ", "धन्यवाद।"},
+		},
+		{
+			name:     "hebrew",
+			input:    "שלום עולם. מה שלומך?",
+			expected: []string{"שלום עולם. ", "מה שלומך?"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := prompt.Sentences(tt.input)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Sentences() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	enc := tokenizer.Default()
+	text := "The first sentence is here. The second one follows. The third one ends the text."
+	limit := enc.Count("The third one ends the text.") + 2
+
+	tests := []struct {
+		strategy prompt.Strategy
+		check    func(string) bool
+	}{
+		{prompt.TruncateHead, func(s string) bool { return strings.HasPrefix(text, s) && s != "" }},
+		{prompt.TruncateTail, func(s string) bool { return strings.HasSuffix(text, s) && s != "" }},
+		{prompt.TruncateMiddle, func(s string) bool {
+			head, tail, ok := strings.Cut(s, prompt.Ellipsis)
+			return ok && strings.HasPrefix(text, head) && strings.HasSuffix(text, tail)
+		}},
+		{prompt.TruncateSentences, func(s string) bool { return s == "The first sentence is here." }},
+		{prompt.TruncateLastSentences, func(s string) bool { return s == "The third one ends the text." }},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			got, err := prompt.Truncate(text, limit, tt.strategy)
+			if err != nil {
+				t.Fatalf("Truncate() error = %v", err)
+			}
+			if c := enc.Count(got); c > limit {
+				t.Errorf("Truncate() returned %d tokens, limit is %d", c, limit)
+			}
+			if !tt.check(got) {
+				t.Errorf("Truncate() = %q", got)
+			}
+		})
+	}
+	if _, err := prompt.Truncate(text, 1, "random"); err == nil {
+		t.Error("expected an error for an unknown strategy")
+	}
+}
+
+func TestTruncateTemplate(t *testing.T) {
+	input := `<user>{{truncate "last-sentences" 3 .History}}</user>`
+	m, _, err := prompt.ParseMessages(input, map[string]string{"History": "Old news. Latest."})
+	if err != nil {
+		t.Fatalf("ParseMessages() error = %v", err)
+	}
+	if m[0].Content != "Latest." {
+		t.Errorf("content = %q, want %q", m[0].Content, "Latest.")
+	}
+}
@@ -0,0 +1,275 @@
+package prompt
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+type (
+	// ValidationError lists every variable the template needs and the data doesn't have.
+	// For strict prompt files it also lists every map key the template doesn't use, which is usually a misspelled variable.
+	ValidationError struct {
+		Missing []string
+		Unknown []string
+	}
+
+	// variables are the top level fields of the data referenced by a template.
+	// A field tested by {{if}} or {{with}}, or passed to default, is optional, the others are required.
+	variables struct {
+		required map[string]bool
+		optional map[string]bool
+		// used is where each variable is first referenced
+		used map[string]Position
+		// strict makes map keys that aren't variables errors
+		strict bool
+	}
+
+	// scope tells whether dot and $ are the template data in a part of a template.
+	scope struct {
+		dot, dollar bool
+	}
+
+	// varsWalker collects the variables of a template and of the templates it includes.
+	varsWalker struct {
+		tmpl    *template.Template
+		tree    *parse.Tree
+		vars    *variables
+		visited map[string]bool
+	}
+)
+
+func (e *ValidationError) Error() string {
+	var parts []string
+	if len(e.Missing) > 0 {
+		parts = append(parts, "missing variables "+strings.Join(e.Missing, ", "))
+	}
+	if len(e.Unknown) > 0 {
+		parts = append(parts, "unknown variables "+strings.Join(e.Unknown, ", "))
+	}
+	return "invalid template data: " + strings.Join(parts, "; ")
+}
+
+// templateVariables infers the variables of the named template.
+func templateVariables(t *template.Template, name string) *variables {
+	w := &varsWalker{
+		tmpl:    t,
+		vars:    &variables{required: map[string]bool{}, optional: map[string]bool{}, used: map[string]Position{}},
+		visited: map[string]bool{},
+	}
+	w.template(name)
+	for v := range w.vars.optional {
+		delete(w.vars.required, v)
+	}
+	return w.vars
+}
+
+// declare adds variables declared by the template author to the inferred ones.
+func (v *variables) declare(required, optional []string) {
+	for _, name := range required {
+		v.required[name] = true
+		delete(v.optional, name)
+	}
+	for _, name := range optional {
+		v.optional[name] = true
+		delete(v.required, name)
+	}
+}
+
+// validate checks data against the variables, it returns the data to execute the template with,
+// where a map misses an optional key it is copied with the key set to nil so missingkey=error doesn't fail.
+// Map keys that aren't variables are only reported with strict, data is often shared by several templates.
+func (v *variables) validate(data any, strict bool) (any, error) {
+	rv := reflect.ValueOf(data)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		rv = rv.Elem()
+	}
+	e := &ValidationError{}
+	switch {
+	case !rv.IsValid():
+		e.Missing = sortedKeys(v.required)
+	case rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String:
+		keys := map[string]bool{}
+		for _, k := range rv.MapKeys() {
+			keys[k.String()] = true
+			if strict && !v.required[k.String()] && !v.optional[k.String()] {
+				e.Unknown = append(e.Unknown, k.String())
+			}
+		}
+		for _, name := range sortedKeys(v.required) {
+			if !keys[name] {
+				e.Missing = append(e.Missing, name)
+			}
+		}
+		if len(e.Missing) == 0 && len(e.Unknown) == 0 {
+			data = fillOptional(rv, keys, v.optional)
+		}
+	case rv.Kind() == reflect.Struct:
+		// a struct is often shared by several templates, so fields the template doesn't use are fine
+		for _, name := range sortedKeys(v.all()) {
+			if !hasField(data, rv, name) {
+				e.Missing = append(e.Missing, name)
+			}
+		}
+	}
+	if len(e.Missing) > 0 || len(e.Unknown) > 0 {
+		sort.Strings(e.Unknown)
+		return nil, e
+	}
+	return data, nil
+}
+
+func (v *variables) all() map[string]bool {
+	all := make(map[string]bool, len(v.required)+len(v.optional))
+	for name := range v.required {
+		all[name] = true
+	}
+	for name := range v.optional {
+		all[name] = true
+	}
+	return all
+}
+
+// fillOptional returns the map with the missing optional keys set to nil.
+func fillOptional(m reflect.Value, keys, optional map[string]bool) any {
+	filled := make(map[string]any, m.Len()+len(optional))
+	for _, k := range m.MapKeys() {
+		filled[k.String()] = m.MapIndex(k).Interface()
+	}
+	for name := range optional {
+		if !keys[name] {
+			filled[name] = nil
+		}
+	}
+	return filled
+}
+
+// hasField reports whether text/template can evaluate .name on the struct, as a field or a method.
+func hasField(data any, rv reflect.Value, name string) bool {
+	if rv.FieldByName(name).IsValid() {
+		return true
+	}
+	return reflect.ValueOf(data).MethodByName(name).IsValid() || rv.MethodByName(name).IsValid()
+}
+
+func (w *varsWalker) template(name string) {
+	if w.visited[name] {
+		return
+	}
+	w.visited[name] = true
+	if t := w.tmpl.Lookup(name); t != nil && t.Tree != nil {
+		tree := w.tree
+		w.tree = t.Tree
+		w.list(t.Tree.Root, scope{dot: true, dollar: true})
+		w.tree = tree
+	}
+}
+
+func (w *varsWalker) list(l *parse.ListNode, s scope) {
+	if l == nil {
+		return
+	}
+	for _, n := range l.Nodes {
+		w.node(n, s)
+	}
+}
+
+func (w *varsWalker) node(n parse.Node, s scope) {
+	switch n := n.(type) {
+	case *parse.ActionNode:
+		w.pipe(n.Pipe, s, false)
+	case *parse.IfNode:
+		w.pipe(n.Pipe, s, true)
+		w.list(n.List, s)
+		w.list(n.ElseList, s)
+	case *parse.WithNode:
+		w.pipe(n.Pipe, s, true)
+		w.list(n.List, scope{dollar: s.dollar})
+		w.list(n.ElseList, s)
+	case *parse.RangeNode:
+		w.pipe(n.Pipe, s, false)
+		w.list(n.List, scope{dollar: s.dollar})
+		w.list(n.ElseList, s)
+	case *parse.TemplateNode:
+		if n.Pipe == nil {
+			return
+		}
+		w.pipe(n.Pipe, s, false)
+		// the included template sees the data only when it is passed as dot
+		if s.dot && isDot(n.Pipe) {
+			w.template(n.Name)
+		}
+	}
+}
+
+func (w *varsWalker) pipe(p *parse.PipeNode, s scope, optional bool) {
+	if p == nil {
+		return
+	}
+	optional = optional || usesDefault(p)
+	for _, c := range p.Cmds {
+		for _, arg := range c.Args {
+			w.arg(arg, s, optional)
+		}
+	}
+}
+
+func (w *varsWalker) arg(n parse.Node, s scope, optional bool) {
+	switch n := n.(type) {
+	case *parse.FieldNode:
+		if s.dot {
+			w.add(n, n.Ident, optional)
+		}
+	case *parse.VariableNode:
+		if s.dollar && n.Ident[0] == "$" && len(n.Ident) > 1 {
+			w.add(n, n.Ident[1:], optional)
+		}
+	case *parse.ChainNode:
+		w.arg(n.Node, s, optional)
+	case *parse.PipeNode:
+		w.pipe(n, s, optional)
+	}
+}
+
+func (w *varsWalker) add(n parse.Node, path []string, optional bool) {
+	if optional {
+		w.vars.optional[path[0]] = true
+	} else {
+		w.vars.required[path[0]] = true
+	}
+	if _, ok := w.vars.used[path[0]]; !ok {
+		w.vars.used[path[0]] = nodePosition(w.tree, n)
+	}
+}
+
+// usesDefault reports whether a pipeline calls the default function, which makes its fields optional.
+func usesDefault(p *parse.PipeNode) bool {
+	for _, c := range p.Cmds {
+		if id, ok := c.Args[0].(*parse.IdentifierNode); ok && id.Ident == "default" {
+			return true
+		}
+	}
+	return false
+}
+
+// isDot reports whether a pipeline is just {{.}}.
+func isDot(p *parse.PipeNode) bool {
+	if len(p.Decl) > 0 || len(p.Cmds) != 1 || len(p.Cmds[0].Args) != 1 {
+		return false
+	}
+	_, ok := p.Cmds[0].Args[0].(*parse.DotNode)
+	return ok
+}
+
+// checkVariables returns an error when a variable can't be used as a template field name.
+func checkVariables(names []string) error {
+	for _, name := range names {
+		if name == "" || strings.ContainsAny(name, ". ") {
+			return fmt.Errorf("invalid variable name %q", name)
+		}
+	}
+	return nil
+}
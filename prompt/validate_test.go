@@ -0,0 +1,125 @@
+package prompt_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+)
+
+type queryData struct {
+	UserQuery string
+}
+
+func (queryData) Upper() string { return "QUERY" }
+
+func TestParseMessagesValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		data        any
+		expected    []prompt.Message
+		wantMissing []string
+		wantUnknown []string
+	}{
+		{
+			name:     "optional field tested by if",
+			input:    "<user>{{if .RAGContext}}Context: {{.RAGContext}} {{end}}{{.UserQuery}}</user>",
+			data:     map[string]string{"UserQuery": "hi"},
+			expected: []prompt.Message{{Role: prompt.RoleUser, Content: "hi"}},
+		},
+		{
+			name:        "every missing key is reported",
+			input:       "<system>{{.SystemPrompt}}</system><user>{{.UserQuery}} {{.RAGContext}}</user>",
+			data:        map[string]string{"UserQuery": "hi", "RagContext": "x", "Sytem": "y"},
+			wantMissing: []string{"RAGContext", "SystemPrompt"},
+		},
+		{
+			name:     "unused keys are fine",
+			input:    "<user>{{.UserQuery}}</user>",
+			data:     map[string]string{"UserQuery": "hi", "Shared": "x"},
+			expected: []prompt.Message{{Role: prompt.RoleUser, Content: "hi"}},
+		},
+		{
+			name:        "struct fields and methods",
+			input:       "<user>{{.UserQuery}} {{.Upper}} {{if .Context}}{{end}} {{.History}}</user>",
+			data:        queryData{UserQuery: "hi"},
+			wantMissing: []string{"Context", "History"},
+		},
+		{
+			name:        "nil data",
+			input:       "<user>{{.UserQuery}}</user>",
+			wantMissing: []string{"UserQuery"},
+		},
+		{
+			name:  "with, range and root variables",
+			input: `<user>{{with .Doc}}{{.Title}}{{end}}{{range .Items}}{{.Name}}{{$.Sep}}{{end}}</user>`,
+			data: map[string]any{
+				"Items": []map[string]string{{"Name": "a"}, {"Name": "b"}},
+				"Sep":   ",",
+			},
+			expected: []prompt.Message{{Role: prompt.RoleUser, Content: "a,b,"}},
+		},
+		{
+			name:        "partials called with dot",
+			input:       `{{define "ctx"}}{{.RAGContext}}{{end}}<user>{{template "ctx" .}}{{template "ctx" .Other}}</user>`,
+			data:        map[string]any{"Other": map[string]string{"RAGContext": "x"}},
+			wantMissing: []string{"RAGContext"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := prompt.ParseMessages(tt.input, tt.data)
+			if tt.wantMissing == nil && tt.wantUnknown == nil {
+				if err != nil {
+					t.Fatalf("ParseMessages() error = %v", err)
+				}
+				if !reflect.DeepEqual(got, tt.expected) {
+					t.Errorf("ParseMessages() = %v, want %v", got, tt.expected)
+				}
+				return
+			}
+			var ve *prompt.ValidationError
+			if !errors.As(err, &ve) {
+				t.Fatalf("expected a *ValidationError, got %v", err)
+			}
+			if !reflect.DeepEqual(ve.Missing, tt.wantMissing) || !reflect.DeepEqual(ve.Unknown, tt.wantUnknown) {
+				t.Errorf("ValidationError = %+v, want missing %v and unknown %v", ve, tt.wantMissing, tt.wantUnknown)
+			}
+		})
+	}
+}
+
+func TestParseMessagesMissingNestedKey(t *testing.T) {
+	_, _, err := prompt.ParseMessages("<user>{{.Doc.Title}}</user>", map[string]any{"Doc": map[string]string{}})
+	if err == nil {
+		t.Error("expected an error for a missing map key")
+	}
+}
+
+func TestStrictFileValidation(t *testing.T) {
+	src := "<system>{{.SystemPrompt}}</system><user>{{.UserQuery}}</user>"
+	data := map[string]string{"UserQuery": "hi", "Sytem": "y"}
+	f, err := prompt.ParseFile("qa", []byte("---\nstrict: true\n---\n"+src))
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+	_, _, err = f.Render(data)
+	var ve *prompt.ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expected a *ValidationError, got %v", err)
+	}
+	if !reflect.DeepEqual(ve.Missing, []string{"SystemPrompt"}) || !reflect.DeepEqual(ve.Unknown, []string{"Sytem"}) {
+		t.Errorf("ValidationError = %+v, want missing [SystemPrompt] and unknown [Sytem]", ve)
+	}
+
+	f, err = prompt.ParseFile("qa", []byte(src))
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+	_, _, err = f.Render(data)
+	if !errors.As(err, &ve) || ve.Unknown != nil {
+		t.Errorf("expected only missing variables without strict, got %v", err)
+	}
+}
@@ -0,0 +1,283 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+)
+
+type (
+	// BatchRequest is a single chat completion request in a batch, CustomID is used to map the result back to the request
+	BatchRequest struct {
+		CustomID string
+		Messages []prompt.Message
+	}
+
+	// BatchResult is the outcome of a single request in a batch
+	BatchResult struct {
+		CustomID string
+		Content  []byte
+		Err      error
+	}
+
+	// Batch represents an OpenAI batch job
+	Batch struct {
+		ID               string             `json:"id"`
+		Status           string             `json:"status"`
+		InputFileID      string             `json:"input_file_id"`
+		OutputFileID     string             `json:"output_file_id"`
+		ErrorFileID      string             `json:"error_file_id"`
+		CompletionWindow string             `json:"completion_window"`
+		RequestCounts    BatchRequestCounts `json:"request_counts"`
+	}
+
+	// BatchRequestCounts holds the progress of a batch job
+	BatchRequestCounts struct {
+		Total     int `json:"total"`
+		Completed int `json:"completed"`
+		Failed    int `json:"failed"`
+	}
+
+	// batchLine is a single line of the batch input JSONL file
+	batchLine struct {
+		CustomID string         `json:"custom_id"`
+		Method   string         `json:"method"`
+		URL      string         `json:"url"`
+		Body     requestPayload `json:"body"`
+	}
+
+	// batchOutputLine is a single line of the batch output or error JSONL file
+	batchOutputLine struct {
+		CustomID string `json:"custom_id"`
+		Response *struct {
+			StatusCode int             `json:"status_code"`
+			Body       responsePayload `json:"body"`
+		} `json:"response"`
+		Error *struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+
+	// createBatchPayload is the JSON payload we send to create a batch
+	createBatchPayload struct {
+		InputFileID      string `json:"input_file_id"`
+		Endpoint         string `json:"endpoint"`
+		CompletionWindow string `json:"completion_window"`
+	}
+
+	// fileResponsePayload is the JSON payload we receive after uploading a file
+	fileResponsePayload struct {
+		ID string `json:"id"`
+	}
+)
+
+const (
+	filesEndpoint   = "/files"
+	batchesEndpoint = "/batches"
+)
+
+// Done reports whether the batch reached a terminal status.
+func (b Batch) Done() bool {
+	switch b.Status {
+	case "completed", "failed", "expired", "cancelled":
+		return true
+	}
+	return false
+}
+
+// WriteBatchFile serializes the requests into the batch JSONL format.
+func (p OpenAIProvider) WriteBatchFile(w io.Writer, reqs []BatchRequest) error {
+	enc := json.NewEncoder(w)
+	seen := make(map[string]bool, len(reqs))
+	for _, r := range reqs {
+		if r.CustomID == "" {
+			return fmt.Errorf("batch request is missing a custom id")
+		}
+		if seen[r.CustomID] {
+			return fmt.Errorf("duplicate batch custom id %q", r.CustomID)
+		}
+		seen[r.CustomID] = true
+		body, err := p.chatPayload(r.Messages)
+		if err != nil {
+			return fmt.Errorf("batch request %q: %v", r.CustomID, err)
+		}
+		if err := enc.Encode(batchLine{
+			CustomID: r.CustomID,
+			Method:   http.MethodPost,
+			URL:      "/v1" + endpoint,
+			Body:     body,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UploadBatchFile uploads a batch JSONL file and returns its file id.
+func (p OpenAIProvider) UploadBatchFile(name string, r io.Reader) (string, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	if err := mw.WriteField("purpose", "batch"); err != nil {
+		return "", err
+	}
+	fw, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(fw, r); err != nil {
+		return "", err
+	}
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+	body, err := p.do(http.MethodPost, filesEndpoint, mw.FormDataContentType(), buf.Bytes())
+	if err != nil {
+		return "", err
+	}
+	var f fileResponsePayload
+	if err := json.Unmarshal(body, &f); err != nil {
+		return "", err
+	}
+	return f.ID, nil
+}
+
+// CreateBatch creates a chat completion batch job from an uploaded input file.
+func (p OpenAIProvider) CreateBatch(inputFileID string) (*Batch, error) {
+	payloadBytes, err := json.Marshal(createBatchPayload{
+		InputFileID:      inputFileID,
+		Endpoint:         "/v1" + endpoint,
+		CompletionWindow: "24h",
+	})
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.do(http.MethodPost, batchesEndpoint, "application/json", payloadBytes)
+	if err != nil {
+		return nil, err
+	}
+	var b Batch
+	if err := json.Unmarshal(body, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// RetrieveBatch returns the current state of a batch job.
+func (p OpenAIProvider) RetrieveBatch(id string) (*Batch, error) {
+	return p.retrieveBatch(context.Background(), id)
+}
+
+func (p OpenAIProvider) retrieveBatch(ctx context.Context, id string) (*Batch, error) {
+	body, err := p.doContext(ctx, http.MethodGet, batchesEndpoint+"/"+id, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	var b Batch
+	if err := json.Unmarshal(body, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// WaitBatch polls a batch job every interval until it reaches a terminal status or ctx is done.
+// Batches can take up to their 24h completion window, so callers should bound ctx.
+func (p OpenAIProvider) WaitBatch(ctx context.Context, id string, interval time.Duration) (*Batch, error) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		b, err := p.retrieveBatch(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if b.Done() {
+			return b, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("batch %s is %s: %w", id, b.Status, ctx.Err())
+		case <-t.C:
+		}
+	}
+}
+
+// BatchResults downloads the output and error files of a finished batch and maps the results by custom id.
+func (p OpenAIProvider) BatchResults(b *Batch) (map[string]BatchResult, error) {
+	if b.Status != "completed" {
+		return nil, fmt.Errorf("batch %s is %s", b.ID, b.Status)
+	}
+	results := make(map[string]BatchResult, b.RequestCounts.Total)
+	for _, id := range []string{b.OutputFileID, b.ErrorFileID} {
+		if id == "" {
+			continue
+		}
+		body, err := p.do(http.MethodGet, filesEndpoint+"/"+id+"/content", "", nil)
+		if err != nil {
+			return nil, fmt.Errorf("error downloading batch file %s: %v", id, err)
+		}
+		if err := parseBatchOutput(body, results); err != nil {
+			return nil, fmt.Errorf("error parsing batch file %s: %v", id, err)
+		}
+	}
+	return results, nil
+}
+
+// RunBatch writes, uploads and creates a batch for the requests, waits for it to finish and returns its results.
+// It stops waiting when ctx is done, the batch keeps running and can be retrieved by its ID later.
+func (p OpenAIProvider) RunBatch(ctx context.Context, reqs []BatchRequest, interval time.Duration) (map[string]BatchResult, error) {
+	var buf bytes.Buffer
+	if err := p.WriteBatchFile(&buf, reqs); err != nil {
+		return nil, fmt.Errorf("error writing batch file: %v", err)
+	}
+	fileID, err := p.UploadBatchFile("batch.jsonl", &buf)
+	if err != nil {
+		return nil, fmt.Errorf("error uploading batch file: %v", err)
+	}
+	b, err := p.CreateBatch(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("error creating batch: %v", err)
+	}
+	b, err = p.WaitBatch(ctx, b.ID, interval)
+	if err != nil {
+		return nil, fmt.Errorf("error waiting for batch: %w", err)
+	}
+	return p.BatchResults(b)
+}
+
+// parseBatchOutput parses a batch output or error JSONL file into results.
+func parseBatchOutput(data []byte, results map[string]BatchResult) error {
+	s := bufio.NewScanner(bytes.NewReader(data))
+	s.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for s.Scan() {
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+		var l batchOutputLine
+		if err := json.Unmarshal(s.Bytes(), &l); err != nil {
+			return err
+		}
+		r := BatchResult{CustomID: l.CustomID}
+		switch {
+		case l.Error != nil:
+			r.Err = fmt.Errorf("%s: %s", l.Error.Code, l.Error.Message)
+		case l.Response == nil:
+			r.Err = fmt.Errorf("missing response")
+		case l.Response.StatusCode != http.StatusOK:
+			r.Err = fmt.Errorf("unexpected status code: %d", l.Response.StatusCode)
+		case len(l.Response.Body.Choices) == 0:
+			r.Err = fmt.Errorf("no choices in response")
+		default:
+			r.Content = []byte(l.Response.Body.Choices[0].Message.Content)
+		}
+		results[l.CustomID] = r
+	}
+	return s.Err()
+}
@@ -0,0 +1,160 @@
+package provider_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+	"github.com/yonidavidson/gopherconil.talk/provider"
+)
+
+// batchServer is a local stand-in for the OpenAI files and batches endpoints.
+type batchServer struct {
+	mu     sync.Mutex
+	input  []byte
+	polls  int
+	status string
+	// stuck keeps the batch in progress forever
+	stuck bool
+}
+
+func (s *batchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer test-key" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/files":
+		if r.FormValue("purpose") != "batch" {
+			http.Error(w, "bad purpose", http.StatusBadRequest)
+			return
+		}
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.input, _ = io.ReadAll(f)
+		fmt.Fprint(w, `{"id":"file-in"}`)
+	case r.Method == http.MethodPost && r.URL.Path == "/batches":
+		s.status = "validating"
+		fmt.Fprint(w, `{"id":"batch-1","status":"validating","input_file_id":"file-in"}`)
+	case r.Method == http.MethodGet && r.URL.Path == "/batches/batch-1":
+		s.polls++
+		if s.polls > 2 && !s.stuck {
+			s.status = "completed"
+		}
+		fmt.Fprintf(w, `{"id":"batch-1","status":%q,"output_file_id":"file-out","error_file_id":"file-err","request_counts":{"total":2,"completed":1,"failed":1}}`, s.status)
+	case r.Method == http.MethodGet && r.URL.Path == "/files/file-out/content":
+		// answer every request in the uploaded input by echoing its last message
+		sc := bufio.NewScanner(bytes.NewReader(s.input))
+		for sc.Scan() {
+			var l struct {
+				CustomID string `json:"custom_id"`
+				Body     struct {
+					Messages []struct {
+						Content string `json:"content"`
+					} `json:"messages"`
+				} `json:"body"`
+			}
+			if err := json.Unmarshal(sc.Bytes(), &l); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if l.CustomID == "q2" {
+				continue
+			}
+			content, _ := json.Marshal(l.Body.Messages[len(l.Body.Messages)-1].Content)
+			fmt.Fprintf(w, `{"custom_id":%q,"response":{"status_code":200,"body":{"choices":[{"message":{"role":"assistant","content":%s}}]}},"error":null}`+"\n", l.CustomID, content)
+		}
+	case r.Method == http.MethodGet && r.URL.Path == "/files/file-err/content":
+		fmt.Fprint(w, `{"custom_id":"q2","response":null,"error":{"code":"invalid_request","message":"bad request"}}`+"\n")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestWriteBatchFile(t *testing.T) {
+	p := provider.OpenAIProvider{APIKey: "test-key"}
+	var buf bytes.Buffer
+	err := p.WriteBatchFile(&buf, []provider.BatchRequest{
+		{CustomID: "q1", Messages: []prompt.Message{{Role: prompt.RoleUser, Content: "hello"}}},
+	})
+	if err != nil {
+		t.Fatalf("WriteBatchFile() error = %v", err)
+	}
+	var l struct {
+		CustomID string `json:"custom_id"`
+		Method   string `json:"method"`
+		URL      string `json:"url"`
+		Body     struct {
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		} `json:"body"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &l); err != nil {
+		t.Fatalf("invalid batch line %q: %v", buf.String(), err)
+	}
+	if l.CustomID != "q1" || l.Method != "POST" || l.URL != "/v1/chat/completions" {
+		t.Errorf("unexpected batch line %+v", l)
+	}
+	if len(l.Body.Messages) != 1 || l.Body.Messages[0].Role != "user" || l.Body.Messages[0].Content != "hello" {
+		t.Errorf("unexpected batch body %+v", l.Body)
+	}
+
+	err = p.WriteBatchFile(io.Discard, []provider.BatchRequest{{CustomID: "q1"}, {CustomID: "q1"}})
+	if err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Errorf("expected a duplicate custom id error, got %v", err)
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	srv := httptest.NewServer(&batchServer{})
+	defer srv.Close()
+	p := provider.OpenAIProvider{APIKey: "test-key", BaseURL: srv.URL}
+
+	results, err := p.RunBatch(context.Background(), []provider.BatchRequest{
+		{CustomID: "q1", Messages: []prompt.Message{{Role: prompt.RoleUser, Content: "first"}}},
+		{CustomID: "q2", Messages: []prompt.Message{{Role: prompt.RoleUser, Content: "second"}}},
+	}, time.Millisecond)
+	if err != nil {
+		t.Fatalf("RunBatch() error = %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if r := results["q1"]; r.Err != nil || string(r.Content) != "first" {
+		t.Errorf("unexpected result for q1: %+v", r)
+	}
+	if r := results["q2"]; r.Err == nil || !strings.Contains(r.Err.Error(), "bad request") {
+		t.Errorf("expected an error for q2, got %+v", r)
+	}
+}
+
+func TestWaitBatchContext(t *testing.T) {
+	srv := httptest.NewServer(&batchServer{status: "in_progress", stuck: true})
+	defer srv.Close()
+	p := provider.OpenAIProvider{APIKey: "test-key", BaseURL: srv.URL}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := p.WaitBatch(ctx, "batch-1", time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a deadline exceeded error, got %v", err)
+	}
+}
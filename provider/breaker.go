@@ -0,0 +1,202 @@
+package provider
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type (
+	// BreakerConfig configures a CircuitBreaker, zero values fall back to defaults
+	BreakerConfig struct {
+		// Window is the number of recent calls used to compute the failure rate (default 20)
+		Window int
+		// MinRequests is the number of calls in the window needed before the breaker can open (default 5)
+		MinRequests int
+		// FailureRate is the failure ratio in the window that opens the breaker (default 0.5)
+		FailureRate float64
+		// OpenTimeout is how long the breaker stays open before letting probes through (default 30s)
+		OpenTimeout time.Duration
+		// HalfOpenRequests is the number of probes allowed while half-open (default 1)
+		HalfOpenRequests int
+	}
+
+	// BreakerState is the state of a CircuitBreaker
+	BreakerState int
+
+	// CircuitBreaker stops calling a backend once its recent failure rate is too high.
+	// It is closed while healthy, open while rejecting calls, and half-open while probing after OpenTimeout.
+	CircuitBreaker struct {
+		cfg      BreakerConfig
+		mu       sync.Mutex
+		state    BreakerState
+		outcomes []bool
+		openedAt time.Time
+		probes   int
+		// generation counts state changes, outcomes of calls allowed in an older one are stale
+		generation uint64
+		now        func() time.Time
+	}
+)
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+// ErrCircuitOpen is returned without calling the backend while its circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// NewCircuitBreaker creates a closed CircuitBreaker.
+func NewCircuitBreaker(cfg BreakerConfig) *CircuitBreaker {
+	if cfg.Window <= 0 {
+		cfg.Window = 20
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 5
+	}
+	if cfg.MinRequests > cfg.Window {
+		cfg.MinRequests = cfg.Window
+	}
+	if cfg.FailureRate <= 0 {
+		cfg.FailureRate = 0.5
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 30 * time.Second
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+	return &CircuitBreaker{cfg: cfg, now: time.Now}
+}
+
+// WithCircuitBreaker guards each backend (chat completions, embeddings, moderation) with its own CircuitBreaker.
+func WithCircuitBreaker(cfg BreakerConfig) Option {
+	return func(p *OpenAIProvider) {
+		p.breakers = map[string]*CircuitBreaker{
+			endpoint:           NewCircuitBreaker(cfg),
+			embeddingEndpoint:  NewCircuitBreaker(cfg),
+			moderationEndpoint: NewCircuitBreaker(cfg),
+		}
+	}
+}
+
+// Breaker returns the circuit breaker guarding an API path such as "/chat/completions", or nil.
+func (p OpenAIProvider) Breaker(path string) *CircuitBreaker {
+	return p.breakers[path]
+}
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	return b.state
+}
+
+// Allow reports whether a call may proceed, it returns ErrCircuitOpen otherwise.
+// Every allowed call must be followed by a call to Record with the returned generation.
+func (b *CircuitBreaker) Allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	switch b.state {
+	case BreakerOpen:
+		return 0, ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.probes >= b.cfg.HalfOpenRequests {
+			return 0, ErrCircuitOpen
+		}
+		b.probes++
+	}
+	return b.generation, nil
+}
+
+// Record reports the outcome of a call allowed in generation.
+// Outcomes of calls allowed before the breaker last changed state are ignored,
+// so a slow call started while closed can't close or reopen a half-open breaker.
+func (b *CircuitBreaker) Record(generation uint64, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		return
+	}
+	switch b.state {
+	case BreakerHalfOpen:
+		if !success {
+			b.trip()
+			return
+		}
+		b.probes--
+		if b.probes == 0 {
+			b.reset()
+		}
+	case BreakerClosed:
+		b.outcomes = append(b.outcomes, success)
+		if len(b.outcomes) > b.cfg.Window {
+			b.outcomes = b.outcomes[1:]
+		}
+		if len(b.outcomes) >= b.cfg.MinRequests && b.failureRate() >= b.cfg.FailureRate {
+			b.trip()
+		}
+	}
+}
+
+// advance moves an open breaker to half-open once OpenTimeout elapsed.
+func (b *CircuitBreaker) advance() {
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.cfg.OpenTimeout {
+		b.state = BreakerHalfOpen
+		b.probes = 0
+		b.generation++
+	}
+}
+
+func (b *CircuitBreaker) trip() {
+	b.state = BreakerOpen
+	b.openedAt = b.now()
+	b.outcomes = nil
+	b.probes = 0
+	b.generation++
+}
+
+func (b *CircuitBreaker) reset() {
+	b.state = BreakerClosed
+	b.outcomes = nil
+	b.probes = 0
+	b.generation++
+}
+
+func (b *CircuitBreaker) failureRate() float64 {
+	var failures int
+	for _, ok := range b.outcomes {
+		if !ok {
+			failures++
+		}
+	}
+	return float64(failures) / float64(len(b.outcomes))
+}
+
+// isBackendFailure reports whether err means the backend is unhealthy, client errors such as 400 don't count.
+func isBackendFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.StatusCode >= http.StatusInternalServerError || se.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
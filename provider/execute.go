@@ -0,0 +1,71 @@
+package provider
+
+import (
+	"regexp"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+)
+
+type (
+	// responseFormat is the response_format of a chat completion request
+	responseFormat struct {
+		Type       string      `json:"type"`
+		JSONSchema *jsonSchema `json:"json_schema,omitempty"`
+	}
+
+	jsonSchema struct {
+		Name   string         `json:"name"`
+		Schema map[string]any `json:"schema"`
+	}
+)
+
+// nameInvalid matches the characters not allowed in message names and response schema names.
+var nameInvalid = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// Execute renders a prompt file with data and runs it with the model, temperature, max tokens
+// and response schema of its front matter, the provider settings fill in the rest.
+func (p OpenAIProvider) Execute(f *prompt.File, data any) ([]byte, Usage, error) {
+	m, _, err := f.Render(data)
+	if err != nil {
+		return nil, Usage{}, err
+	}
+	payload, err := p.filePayload(f, m)
+	if err != nil {
+		return nil, Usage{}, err
+	}
+	return p.complete(payload)
+}
+
+// filePayload builds the chat payload for the messages of a prompt file.
+func (p OpenAIProvider) filePayload(f *prompt.File, m []prompt.Message) (requestPayload, error) {
+	if f.Model != "" {
+		p.Model = f.Model
+	}
+	payload, err := p.chatPayload(m)
+	if err != nil {
+		return payload, err
+	}
+	if f.MaxTokens > 0 {
+		if payload.MaxCompletionTokens > 0 {
+			payload.MaxCompletionTokens = f.MaxTokens
+		} else {
+			payload.MaxTokens = f.MaxTokens
+		}
+	}
+	// reasoning models don't take a temperature
+	if f.Temperature != nil && payload.Temperature != nil {
+		temperature := *f.Temperature
+		payload.Temperature = &temperature
+	}
+	if f.ResponseSchema != nil {
+		name := nameInvalid.ReplaceAllString(f.Name, "_")
+		if name == "" {
+			name = "response"
+		}
+		payload.ResponseFormat = &responseFormat{
+			Type:       "json_schema",
+			JSONSchema: &jsonSchema{Name: name, Schema: f.ResponseSchema},
+		}
+	}
+	return payload, nil
+}
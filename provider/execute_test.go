@@ -0,0 +1,63 @@
+package provider_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+	"github.com/yonidavidson/gopherconil.talk/provider"
+)
+
+func TestExecute(t *testing.T) {
+	var payload map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("invalid request: %v", err)
+		}
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"{\"answer\":\"42\"}"}}]}`)
+	}))
+	defer srv.Close()
+	p := provider.OpenAIProvider{APIKey: "test-key", BaseURL: srv.URL}
+
+	f, err := prompt.ParseFile("qa/answer", []byte(`---
+model: gpt-4o
+temperature: 0.2
+max_tokens: 300
+response_schema:
+  type: object
+---
+<user>{{.Query}}</user>`))
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+	c, _, err := p.Execute(f, map[string]string{"Query": "why?"})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if string(c) != `{"answer":"42"}` {
+		t.Errorf("Execute() = %s", c)
+	}
+	if payload["model"] != "gpt-4o" || payload["temperature"] != 0.2 || payload["max_tokens"] != 300.0 {
+		t.Errorf("settings not applied: %v", payload)
+	}
+	want := map[string]any{"type": "json_schema", "json_schema": map[string]any{"name": "qa_answer", "schema": map[string]any{"type": "object"}}}
+	if !reflect.DeepEqual(payload["response_format"], want) {
+		t.Errorf("response_format = %v, want %v", payload["response_format"], want)
+	}
+
+	f, err = prompt.ParseFile("reasoning", []byte("---\nmodel: o3-mini\ntemperature: 0.2\nmax_tokens: 300\n---\n<user>hi</user>"))
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+	payload = nil
+	if _, _, err := p.Execute(f, nil); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if _, ok := payload["temperature"]; ok || payload["max_completion_tokens"] != 300.0 {
+		t.Errorf("reasoning settings not applied: %v", payload)
+	}
+}
@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// HedgeConfig configures hedged requests, zero values fall back to defaults
+	HedgeConfig struct {
+		// Percentile of recent latencies after which a second attempt is fired (default 0.95)
+		Percentile float64
+		// MinSamples is the number of observed latencies needed before hedging starts (default 20)
+		MinSamples int
+		// Window is the number of recent latencies kept (default 100)
+		Window int
+		// MinDelay is a floor for the hedging delay
+		MinDelay time.Duration
+	}
+
+	// hedger tracks request latencies and decides when to fire a hedged attempt
+	hedger struct {
+		cfg       HedgeConfig
+		mu        sync.Mutex
+		latencies []time.Duration
+	}
+
+	// attempt is the outcome of a single request attempt
+	attempt struct {
+		body []byte
+		err  error
+		took time.Duration
+	}
+)
+
+// WithHedging fires a second attempt for chat completions, embeddings and moderation when the first one is slower
+// than the configured latency percentile, the first successful answer wins and the other attempt is cancelled.
+func WithHedging(cfg HedgeConfig) Option {
+	if cfg.Percentile <= 0 || cfg.Percentile > 1 {
+		cfg.Percentile = 0.95
+	}
+	if cfg.MinSamples <= 0 {
+		cfg.MinSamples = 20
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 100
+	}
+	return func(p *OpenAIProvider) {
+		p.hedger = &hedger{cfg: cfg}
+	}
+}
+
+// observe records the latency of a successful request.
+func (h *hedger) observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.latencies = append(h.latencies, d)
+	if len(h.latencies) > h.cfg.Window {
+		h.latencies = h.latencies[1:]
+	}
+}
+
+// delay returns how long to wait before hedging, false means there are not enough samples yet.
+func (h *hedger) delay() (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.latencies) < h.cfg.MinSamples {
+		return 0, false
+	}
+	sorted := append([]time.Duration(nil), h.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	d := sorted[int(float64(len(sorted)-1)*h.cfg.Percentile)]
+	if d < h.cfg.MinDelay {
+		d = h.cfg.MinDelay
+	}
+	return d, true
+}
+
+// post sends a JSON payload to a backend, guarded by its circuit breaker and hedged when configured.
+func (p OpenAIProvider) post(path string, payload []byte) ([]byte, error) {
+	b := p.breakers[path]
+	var generation uint64
+	if b != nil {
+		var err error
+		if generation, err = b.Allow(); err != nil {
+			return nil, err
+		}
+	}
+	body, err := p.hedged(path, payload)
+	if b != nil {
+		b.Record(generation, !isBackendFailure(err))
+	}
+	return body, err
+}
+
+// hedged sends the request and, once the hedging delay passes without an answer, a second identical one.
+func (p OpenAIProvider) hedged(path string, payload []byte) ([]byte, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results := make(chan attempt, 2)
+	send := func() {
+		start := time.Now()
+		body, err := p.doContext(ctx, http.MethodPost, path, "application/json", payload)
+		results <- attempt{body: body, err: err, took: time.Since(start)}
+	}
+	go send()
+	inflight := 1
+
+	var timer <-chan time.Time
+	if p.hedger != nil {
+		if d, ok := p.hedger.delay(); ok {
+			t := time.NewTimer(d)
+			defer t.Stop()
+			timer = t.C
+		}
+	}
+
+	var last attempt
+	for inflight > 0 {
+		select {
+		case <-timer:
+			timer = nil
+			go send()
+			inflight++
+		case a := <-results:
+			inflight--
+			if a.err == nil {
+				if p.hedger != nil {
+					p.hedger.observe(a.took)
+				}
+				return a.body, nil
+			}
+			last = a
+			if timer != nil && inflight == 0 {
+				// the first attempt failed before the hedging delay, there is nothing to race against
+				return nil, a.err
+			}
+		}
+	}
+	return nil, last.err
+}
@@ -0,0 +1,193 @@
+package provider
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+type (
+	// KeySource is a place an OpenAI API key can be read from
+	KeySource interface {
+		// Key returns the API key, or an error explaining why the source has none
+		Key() (string, error)
+		// String describes the source in error messages, it must never include the key itself
+		String() string
+	}
+
+	// KeyPool is a set of API keys that rotates to the next key when the current one is rate limited
+	KeyPool struct {
+		mu      sync.Mutex
+		keys    []string
+		current int
+	}
+
+	// KeyError is returned when no API key could be resolved, it names every source that was tried
+	KeyError struct {
+		Sources []string
+		Errs    []error
+	}
+
+	envKey     string
+	envFileKey string
+	fileKey    string
+	commandKey []string
+)
+
+// EnvKey reads the key from an environment variable.
+func EnvKey(name string) KeySource {
+	return envKey(name)
+}
+
+// EnvFileKey reads the key from the file named by an environment variable, following the Docker *_FILE convention.
+func EnvFileKey(name string) KeySource {
+	return envFileKey(name)
+}
+
+// FileKey reads the key from a file such as a Docker secret (/run/secrets/openai_key)
+// or a Kubernetes secret volume (/var/run/secrets/openai/api-key), surrounding whitespace is trimmed.
+func FileKey(path string) KeySource {
+	return fileKey(path)
+}
+
+// CommandKey runs a credential helper and uses its trimmed standard output as the key.
+func CommandKey(name string, args ...string) KeySource {
+	return commandKey(append([]string{name}, args...))
+}
+
+// WithKeySources reads the API key from the first source that has one.
+func WithKeySources(sources ...KeySource) Option {
+	return func(p *OpenAIProvider) {
+		p.keySources = sources
+		p.poolKeys = false
+	}
+}
+
+// WithKeyPool reads a key from every source that has one and rotates between them on 429 responses.
+func WithKeyPool(sources ...KeySource) Option {
+	return func(p *OpenAIProvider) {
+		p.keySources = sources
+		p.poolKeys = true
+	}
+}
+
+// NewKeyPool creates a KeyPool starting at the first key.
+func NewKeyPool(keys ...string) *KeyPool {
+	return &KeyPool{keys: keys}
+}
+
+// Len returns the number of keys in the pool.
+func (kp *KeyPool) Len() int {
+	return len(kp.keys)
+}
+
+// Current returns the key in use.
+func (kp *KeyPool) Current() string {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	return kp.keys[kp.current]
+}
+
+// Rotate moves to the next key if from is still the current one, and returns the key to use.
+// Concurrent requests that hit a 429 with the same key rotate the pool only once.
+func (kp *KeyPool) Rotate(from string) string {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	if kp.keys[kp.current] == from {
+		kp.current = (kp.current + 1) % len(kp.keys)
+	}
+	return kp.keys[kp.current]
+}
+
+func (e *KeyError) Error() string {
+	tried := make([]string, len(e.Sources))
+	for i, s := range e.Sources {
+		tried[i] = fmt.Sprintf("%s (%v)", s, e.Errs[i])
+	}
+	return "no OpenAI API key found, tried: " + strings.Join(tried, ", ")
+}
+
+// resolveKeys returns the key of the first source that has one, or the keys of all such sources when all is set.
+func resolveKeys(sources []KeySource, all bool) ([]string, error) {
+	var keys []string
+	kerr := &KeyError{}
+	for _, s := range sources {
+		k, err := s.Key()
+		if err == nil && k == "" {
+			err = fmt.Errorf("empty key")
+		}
+		if err != nil {
+			kerr.Sources = append(kerr.Sources, s.String())
+			kerr.Errs = append(kerr.Errs, err)
+			continue
+		}
+		keys = append(keys, k)
+		if !all {
+			break
+		}
+	}
+	if len(keys) == 0 {
+		if len(sources) == 0 {
+			return nil, fmt.Errorf("no OpenAI API key sources configured")
+		}
+		return nil, kerr
+	}
+	return keys, nil
+}
+
+func (e envKey) Key() (string, error) {
+	k, ok := os.LookupEnv(string(e))
+	if !ok {
+		return "", fmt.Errorf("not set")
+	}
+	return strings.TrimSpace(k), nil
+}
+
+func (e envKey) String() string {
+	return "environment variable " + string(e)
+}
+
+func (e envFileKey) Key() (string, error) {
+	path, ok := os.LookupEnv(string(e))
+	if !ok {
+		return "", fmt.Errorf("not set")
+	}
+	return fileKey(path).Key()
+}
+
+func (e envFileKey) String() string {
+	return "file named by environment variable " + string(e)
+}
+
+func (f fileKey) Key() (string, error) {
+	b, err := os.ReadFile(string(f))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func (f fileKey) String() string {
+	return "file " + string(f)
+}
+
+func (c commandKey) Key() (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(c[0], c[1:]...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%v: %s", err, msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (c commandKey) String() string {
+	return "command " + strings.Join(c, " ")
+}
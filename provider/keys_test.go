@@ -0,0 +1,97 @@
+package provider_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+	"github.com/yonidavidson/gopherconil.talk/provider"
+)
+
+func TestKeySources(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "openai_key")
+	if err := os.WriteFile(secret, []byte("file-key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_OPENAI_KEY_FILE", secret)
+
+	tests := []struct {
+		name    string
+		sources []provider.KeySource
+		want    string
+	}{
+		{name: "file", sources: []provider.KeySource{provider.EnvKey("TEST_MISSING_KEY"), provider.FileKey(secret)}, want: "file-key"},
+		{name: "env file", sources: []provider.KeySource{provider.EnvFileKey("TEST_OPENAI_KEY_FILE")}, want: "file-key"},
+		{name: "command", sources: []provider.KeySource{provider.CommandKey("echo", "command-key")}, want: "command-key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := provider.NewOpenAIProvider(provider.WithKeySources(tt.sources...))
+			if err != nil {
+				t.Fatalf("NewOpenAIProvider() error = %v", err)
+			}
+			if p.APIKey != tt.want {
+				t.Errorf("APIKey = %q, want %q", p.APIKey, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeySourcesError(t *testing.T) {
+	_, err := provider.NewOpenAIProvider(provider.WithKeySources(
+		provider.EnvKey("TEST_MISSING_KEY"),
+		provider.FileKey("/nonexistent/openai_key"),
+		provider.CommandKey("false"),
+	))
+	var kerr *provider.KeyError
+	if !errors.As(err, &kerr) {
+		t.Fatalf("expected a *KeyError, got %v", err)
+	}
+	for _, want := range []string{"environment variable TEST_MISSING_KEY", "file /nonexistent/openai_key", "command false"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not name %q", err, want)
+		}
+	}
+}
+
+func TestKeyPoolRotation(t *testing.T) {
+	var used []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		used = append(used, key)
+		if key != "key-2" {
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`)
+	}))
+	defer srv.Close()
+	t.Setenv("TEST_KEY_1", "key-1")
+	t.Setenv("TEST_KEY_2", "key-2")
+	p, err := provider.NewOpenAIProvider(provider.WithKeyPool(
+		provider.EnvKey("TEST_KEY_1"),
+		provider.EnvKey("TEST_MISSING_KEY"),
+		provider.EnvKey("TEST_KEY_2"),
+	))
+	if err != nil {
+		t.Fatalf("NewOpenAIProvider() error = %v", err)
+	}
+	p.BaseURL = srv.URL
+
+	m := []prompt.Message{{Role: prompt.RoleUser, Content: "hi"}}
+	for i := 0; i < 2; i++ {
+		if _, err := p.ChatCompletion(m); err != nil {
+			t.Fatalf("ChatCompletion() error = %v", err)
+		}
+	}
+	if strings.Join(used, ",") != "key-1,key-2,key-2" {
+		t.Errorf("unexpected key usage %v", used)
+	}
+}
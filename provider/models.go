@@ -0,0 +1,73 @@
+package provider
+
+import (
+	"regexp"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+)
+
+// ModelCapabilities describes what a model supports and how its chat payload should be shaped.
+type ModelCapabilities struct {
+	// ContextWindow is the total number of tokens the model accepts, prompt and completion together.
+	ContextWindow int
+	// MaxOutputTokens is the maximum number of tokens the model can generate.
+	MaxOutputTokens int
+	// Reasoning models take max_completion_tokens instead of max_tokens and don't accept temperature.
+	Reasoning bool
+	// ReasoningEffort reports whether the model accepts reasoning_effort.
+	ReasoningEffort bool
+	// SystemRole is the role system and developer messages are sent with,
+	// the first reasoning models accept neither and get them as user messages.
+	SystemRole prompt.Role
+}
+
+const defaultModel = "gpt-4o-mini-2024-07-18"
+
+var (
+	chat      = ModelCapabilities{ContextWindow: 128000, MaxOutputTokens: 16384, SystemRole: prompt.RoleSystem}
+	turbo     = ModelCapabilities{ContextWindow: 128000, MaxOutputTokens: 4096, SystemRole: prompt.RoleSystem}
+	reasoning = ModelCapabilities{ContextWindow: 200000, MaxOutputTokens: 100000, Reasoning: true, ReasoningEffort: true, SystemRole: prompt.RoleDeveloper}
+
+	// models is the capability table, keyed by model family.
+	// Snapshots such as gpt-4o-mini-2024-07-18 or gpt-3.5-turbo-0125 match their family,
+	// other names sharing a prefix, such as gpt-5-chat-latest, are families of their own.
+	models = map[string]ModelCapabilities{
+		"gpt-4o":             chat,
+		"gpt-4o-mini":        chat,
+		"gpt-4.1":            {ContextWindow: 1047576, MaxOutputTokens: 32768, SystemRole: prompt.RoleSystem},
+		"gpt-4.1-mini":       {ContextWindow: 1047576, MaxOutputTokens: 32768, SystemRole: prompt.RoleSystem},
+		"gpt-4.1-nano":       {ContextWindow: 1047576, MaxOutputTokens: 32768, SystemRole: prompt.RoleSystem},
+		"gpt-4":              {ContextWindow: 8192, MaxOutputTokens: 8192, SystemRole: prompt.RoleSystem},
+		"gpt-4-turbo":        turbo,
+		"gpt-4-1106-preview": turbo,
+		"gpt-4-0125-preview": turbo,
+		"gpt-3.5-turbo":      {ContextWindow: 16385, MaxOutputTokens: 4096, SystemRole: prompt.RoleSystem},
+		"gpt-3.5-turbo-16k":  {ContextWindow: 16385, MaxOutputTokens: 4096, SystemRole: prompt.RoleSystem},
+		"gpt-5-chat-latest":  chat,
+		"o1":                 reasoning,
+		"o1-mini":            {ContextWindow: 128000, MaxOutputTokens: 65536, Reasoning: true, SystemRole: prompt.RoleUser},
+		"o1-preview":         {ContextWindow: 128000, MaxOutputTokens: 32768, Reasoning: true, SystemRole: prompt.RoleUser},
+		"o3":                 reasoning,
+		"o3-mini":            reasoning,
+		"o4-mini":            reasoning,
+		"gpt-5":              {ContextWindow: 400000, MaxOutputTokens: 128000, Reasoning: true, ReasoningEffort: true, SystemRole: prompt.RoleDeveloper},
+		"gpt-5-mini":         {ContextWindow: 400000, MaxOutputTokens: 128000, Reasoning: true, ReasoningEffort: true, SystemRole: prompt.RoleDeveloper},
+		"gpt-5-nano":         {ContextWindow: 400000, MaxOutputTokens: 128000, Reasoning: true, ReasoningEffort: true, SystemRole: prompt.RoleDeveloper},
+	}
+
+	// snapshot matches the suffix of a dated snapshot of a family, or of its preview.
+	snapshot = regexp.MustCompile(`^(.+?)-(\d{4}-\d{2}-\d{2}|\d{4}|preview)$`)
+)
+
+// Capabilities returns the capabilities of a model, models missing from the table are treated as gpt-4o class chat models.
+func Capabilities(model string) ModelCapabilities {
+	if c, ok := models[model]; ok {
+		return c
+	}
+	if m := snapshot.FindStringSubmatch(model); m != nil {
+		if c, ok := models[m[1]]; ok {
+			return c
+		}
+	}
+	return chat
+}
@@ -0,0 +1,64 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+type (
+	// ModerationResult holds the moderation verdict for a single input
+	ModerationResult struct {
+		Flagged        bool               `json:"flagged"`
+		Categories     map[string]bool    `json:"categories"`
+		CategoryScores map[string]float64 `json:"category_scores"`
+	}
+
+	// moderationRequestPayload is the JSON payload we send to the OpenAI API for moderation
+	moderationRequestPayload struct {
+		Model string   `json:"model"`
+		Input []string `json:"input"`
+	}
+
+	// moderationResponsePayload is the JSON payload we receive from the OpenAI API for moderation
+	moderationResponsePayload struct {
+		Results []ModerationResult `json:"results"`
+	}
+)
+
+const moderationEndpoint = "/moderations"
+
+// FlaggedCategories returns the sorted names of the categories that were flagged.
+func (r ModerationResult) FlaggedCategories() []string {
+	var categories []string
+	for c, flagged := range r.Categories {
+		if flagged {
+			categories = append(categories, c)
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// Moderate sends the inputs to the OpenAI moderation endpoint and returns a result per input.
+func (p OpenAIProvider) Moderate(input []string) ([]ModerationResult, error) {
+	payloadBytes, err := json.Marshal(moderationRequestPayload{
+		Model: "omni-moderation-latest",
+		Input: input,
+	})
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.post(moderationEndpoint, payloadBytes)
+	if err != nil {
+		return nil, err
+	}
+	var responsePayload moderationResponsePayload
+	if err := json.Unmarshal(body, &responsePayload); err != nil {
+		return nil, err
+	}
+	if len(responsePayload.Results) != len(input) {
+		return nil, fmt.Errorf("expected %d moderation results, got %d", len(input), len(responsePayload.Results))
+	}
+	return responsePayload.Results, nil
+}
@@ -2,29 +2,65 @@ package provider
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/yonidavidson/gopherconil.talk/prompt"
 	"io"
 	"net/http"
-	"os"
+	"strings"
 )
 
 type (
 	// OpenAIProvider is a provider that uses the OpenAI API
 	OpenAIProvider struct {
 		APIKey string
+		// BaseURL overrides the OpenAI API root, it defaults to https://api.openai.com/v1
+		BaseURL string
+		// Model is the chat model to use, it defaults to gpt-4o-mini-2024-07-18
+		Model string
+		// ReasoningEffort is sent to the reasoning models that accept it only (low, medium or high)
+		ReasoningEffort string
+
+		keySources []KeySource
+		poolKeys   bool
+		keys       *KeyPool
+		breakers   map[string]*CircuitBreaker
+		hedger     *hedger
+	}
+
+	// Option configures an OpenAIProvider
+	Option func(*OpenAIProvider)
+
+	// StatusError is returned when the OpenAI API answers with a non 200 status code
+	StatusError struct {
+		StatusCode int
+		Body       string
+	}
+
+	// Usage reports the tokens consumed by a chat completion, ReasoningTokens are included in CompletionTokens
+	Usage struct {
+		PromptTokens     int
+		CompletionTokens int
+		ReasoningTokens  int
+		TotalTokens      int
 	}
 
 	// requestPayload is the JSON payload we send to the OpenAI API
+	// The shape depends on the model, see ModelCapabilities
 	requestPayload struct {
-		Model       string    `json:"model"`
-		Messages    []message `json:"messages"`
-		MaxTokens   int       `json:"max_tokens"`
-		Temperature float64   `json:"temperature"`
-		TopP        float64   `json:"top_p"`
-		N           int       `json:"n"`
-		Stop        *string   `json:"stop"`
+		Model               string    `json:"model"`
+		Messages            []message `json:"messages"`
+		MaxTokens           int       `json:"max_tokens,omitempty"`
+		MaxCompletionTokens int       `json:"max_completion_tokens,omitempty"`
+		ReasoningEffort     string    `json:"reasoning_effort,omitempty"`
+		Temperature         *float64  `json:"temperature,omitempty"`
+		TopP                *float64  `json:"top_p,omitempty"`
+		N                   int       `json:"n"`
+		Stop                *string   `json:"stop"`
+		// ResponseFormat constrains the answer to a JSON schema
+		ResponseFormat *responseFormat `json:"response_format,omitempty"`
 	}
 
 	// choice struct represents a single choice from the OpenAI API response
@@ -34,7 +70,18 @@ type (
 
 	// responsePayload is the JSON payload we receive from the OpenAI API
 	responsePayload struct {
-		Choices []choice `json:"choices"`
+		Choices []choice     `json:"choices"`
+		Usage   usagePayload `json:"usage"`
+	}
+
+	// usagePayload is the token usage we receive from the OpenAI API
+	usagePayload struct {
+		PromptTokens            int `json:"prompt_tokens"`
+		CompletionTokens        int `json:"completion_tokens"`
+		TotalTokens             int `json:"total_tokens"`
+		CompletionTokensDetails struct {
+			ReasoningTokens int `json:"reasoning_tokens"`
+		} `json:"completion_tokens_details"`
 	}
 
 	// embeddingRequestPayload is the JSON payload we send to the OpenAI API for embedding
@@ -52,97 +99,175 @@ type (
 	}
 
 	message struct {
-		Role    string `json:"role"`
-		Content string `json:"content"`
+		Role       string            `json:"role"`
+		Content    string            `json:"content"`
+		Name       string            `json:"name,omitempty"`
+		ToolCallID string            `json:"tool_call_id,omitempty"`
+		ToolCalls  []prompt.ToolCall `json:"tool_calls,omitempty"`
 	}
 )
 
 const (
-	endpoint          = "https://api.openai.com/v1/chat/completions"
-	embeddingEndpoint = "https://api.openai.com/v1/embeddings"
+	// EmbeddingModel is the model used by TextEmbedding
+	EmbeddingModel = "text-embedding-3-small"
+
+	defaultBaseURL    = "https://api.openai.com/v1"
+	endpoint          = "/chat/completions"
+	embeddingEndpoint = "/embeddings"
+
+	defaultMaxTokens   = 1000
+	defaultTemperature = 0.5
+	defaultTopP        = 1.0
+	// defaultMaxCompletionTokens leaves room for the hidden reasoning tokens of reasoning models
+	defaultMaxCompletionTokens = 4000
 )
 
-// NewOpenAIProvider creates a new instance of OpenAIProvider with the API key from the environment variable.
-func NewOpenAIProvider() (*OpenAIProvider, error) {
-	apiKey := os.Getenv("PRIVATE_OPENAI_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("PRIVATE_OPENAI_KEY environment variable is not set")
+// NewOpenAIProvider creates a new instance of OpenAIProvider.
+// The API key is read from the PRIVATE_OPENAI_KEY environment variable, or from the file named by
+// PRIVATE_OPENAI_KEY_FILE, unless other sources are configured with WithKeySources or WithKeyPool.
+func NewOpenAIProvider(opts ...Option) (*OpenAIProvider, error) {
+	p := &OpenAIProvider{}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.keySources == nil {
+		p.keySources = []KeySource{EnvKey("PRIVATE_OPENAI_KEY"), EnvFileKey("PRIVATE_OPENAI_KEY_FILE")}
+	}
+	keys, err := resolveKeys(p.keySources, p.poolKeys)
+	if err != nil {
+		return nil, err
 	}
-	return &OpenAIProvider{APIKey: apiKey}, nil
+	p.APIKey = keys[0]
+	if p.poolKeys {
+		p.keys = NewKeyPool(keys...)
+	}
+	return p, nil
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d, body: %s", e.StatusCode, e.Body)
 }
 
 // ChatCompletion sends a request to the OpenAI API and returns the response as a byte slice.
 func (p OpenAIProvider) ChatCompletion(m []prompt.Message) ([]byte, error) {
-	// convert from []prompt.Message to []message
-	messages := make([]message, len(m))
-	for i, m := range m {
-		messages[i] = message{
-			Role:    string(m.Role),
-			Content: m.Content,
-		}
-	}
-	// Define the payload with a system talk
-	payload := requestPayload{
-		Model:       "gpt-4o-mini-2024-07-18",
-		Messages:    messages,
-		MaxTokens:   1000,
-		Temperature: 0.5,
-		TopP:        1.0,
-		N:           1,
-		Stop:        nil,
+	c, _, err := p.ChatCompletionWithUsage(m)
+	return c, err
+}
+
+// ChatCompletionWithUsage is like ChatCompletion but also reports the token usage of the request.
+func (p OpenAIProvider) ChatCompletionWithUsage(m []prompt.Message) ([]byte, Usage, error) {
+	payload, err := p.chatPayload(m)
+	if err != nil {
+		return nil, Usage{}, err
 	}
+	return p.complete(payload)
+}
 
+// complete sends a chat completion payload and returns the content of the first choice.
+func (p OpenAIProvider) complete(payload requestPayload) ([]byte, Usage, error) {
 	// Marshal the payload into JSON
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
-		return nil, err
+		return nil, Usage{}, err
 	}
 
-	// Create the HTTP request
-	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(payloadBytes))
+	body, err := p.post(endpoint, payloadBytes)
 	if err != nil {
-		return nil, err
+		return nil, Usage{}, err
+	}
+	var responsePayload responsePayload
+	if err := json.Unmarshal(body, &responsePayload); err != nil {
+		return nil, Usage{}, err
+	}
+	if len(responsePayload.Choices) == 0 {
+		return nil, Usage{}, fmt.Errorf("no choices in response: %s", string(body))
 	}
 
-	// Set the necessary headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	return []byte(responsePayload.Choices[0].Message.Content), responsePayload.Usage.usage(), nil
+}
 
-	// Execute the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+// model returns the configured model or the default one.
+func (p OpenAIProvider) model() string {
+	if p.Model == "" {
+		return defaultModel
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			fmt.Println(err)
+	return p.Model
+}
+
+// chatPayload builds the chat completion payload for the given messages, shaped by the model capabilities.
+// It rejects messages the API would refuse: names with characters other than letters, digits, _ and -,
+// and tool messages that don't answer a tool call of the assistant message before them.
+func (p OpenAIProvider) chatPayload(m []prompt.Message) (requestPayload, error) {
+	model := p.model()
+	caps := Capabilities(model)
+	// calls are the tool calls of the last assistant message still waiting for a result
+	calls := map[string]bool{}
+	// convert from []prompt.Message to []message
+	messages := make([]message, len(m))
+	for i, m := range m {
+		if m.Name != "" && nameInvalid.MatchString(m.Name) {
+			return requestPayload{}, fmt.Errorf("invalid name %q in message %d, use letters, digits, _ and -", m.Name, i+1)
+		}
+		switch m.Role {
+		case prompt.RoleTool:
+			if !calls[m.ToolCallID] {
+				return requestPayload{}, fmt.Errorf("tool message %d answers %q, which isn't a tool call of the assistant message before it", i+1, m.ToolCallID)
+			}
+			delete(calls, m.ToolCallID)
+		case prompt.RoleAssistant:
+			calls = map[string]bool{}
+			for _, c := range m.ToolCalls {
+				calls[c.ID] = true
+			}
+		default:
+			calls = map[string]bool{}
+		}
+		role := m.Role
+		if role == prompt.RoleSystem || role == prompt.RoleDeveloper {
+			role = caps.SystemRole
+		}
+		messages[i] = message{
+			Role:       string(role),
+			Content:    m.Content,
+			Name:       m.Name,
+			ToolCallID: m.ToolCallID,
+			ToolCalls:  m.ToolCalls,
 		}
-	}(resp.Body)
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
 	}
-
-	// Check if the request was successful
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+	payload := requestPayload{
+		Model:    model,
+		Messages: messages,
+		N:        1,
+		Stop:     nil,
 	}
-	var responsePayload responsePayload
-	if err := json.Unmarshal(body, &responsePayload); err != nil {
-		return nil, err
+	if caps.Reasoning {
+		payload.MaxCompletionTokens = defaultMaxCompletionTokens
+		if caps.ReasoningEffort {
+			payload.ReasoningEffort = p.ReasoningEffort
+		}
+		return payload, nil
 	}
+	temperature, topP := defaultTemperature, defaultTopP
+	payload.MaxTokens = defaultMaxTokens
+	payload.Temperature = &temperature
+	payload.TopP = &topP
+	return payload, nil
+}
 
-	return []byte(responsePayload.Choices[0].Message.Content), nil
+func (u usagePayload) usage() Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		ReasoningTokens:  u.CompletionTokensDetails.ReasoningTokens,
+		TotalTokens:      u.TotalTokens,
+	}
 }
 
 // TextEmbedding sends a request to the OpenAI API to get text embeddings and returns the response as a slice of float64.
 func (p OpenAIProvider) TextEmbedding(input []string) ([][]float64, error) {
 	// Define the payload
 	payload := embeddingRequestPayload{
-		Model: "text-embedding-3-small",
+		Model: EmbeddingModel,
 		Input: input,
 	}
 
@@ -152,15 +277,65 @@ func (p OpenAIProvider) TextEmbedding(input []string) ([][]float64, error) {
 		return nil, err
 	}
 
+	body, err := p.post(embeddingEndpoint, payloadBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the response
+	var responsePayload embeddingResponsePayload
+	if err := json.Unmarshal(body, &responsePayload); err != nil {
+		return nil, err
+	}
+
+	// Convert the embedding data to the expected return type
+	embeddings := make([][]float64, len(responsePayload.Data))
+	for i, emb := range responsePayload.Data {
+		embeddings[i] = emb.Embedding
+	}
+
+	return embeddings, nil
+}
+
+// do sends a request to the given API path and returns the response body if the request was successful.
+func (p OpenAIProvider) do(method, path, contentType string, payload []byte) ([]byte, error) {
+	return p.doContext(context.Background(), method, path, contentType, payload)
+}
+
+// doContext is like do but the request is bound to ctx.
+// When a key pool is configured, a 429 response rotates to the next key and retries once per key.
+func (p OpenAIProvider) doContext(ctx context.Context, method, path, contentType string, payload []byte) ([]byte, error) {
+	key := p.APIKey
+	if p.keys != nil {
+		key = p.keys.Current()
+	}
+	for attempt := 1; ; attempt++ {
+		body, err := p.send(ctx, method, path, contentType, payload, key)
+		var se *StatusError
+		if p.keys == nil || attempt >= p.keys.Len() || !errors.As(err, &se) || se.StatusCode != http.StatusTooManyRequests {
+			return body, err
+		}
+		key = p.keys.Rotate(key)
+	}
+}
+
+// send executes a single request with the given API key.
+func (p OpenAIProvider) send(ctx context.Context, method, path, contentType string, payload []byte, key string) ([]byte, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
 	// Create the HTTP request
-	req, err := http.NewRequest("POST", embeddingEndpoint, bytes.NewBuffer(payloadBytes))
+	req, err := http.NewRequestWithContext(ctx, method, p.url(path), reader)
 	if err != nil {
 		return nil, err
 	}
 
 	// Set the necessary headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
 
 	// Execute the request
 	client := &http.Client{}
@@ -183,20 +358,15 @@ func (p OpenAIProvider) TextEmbedding(input []string) ([][]float64, error) {
 
 	// Check if the request was successful
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
+	return body, nil
+}
 
-	// Unmarshal the response
-	var responsePayload embeddingResponsePayload
-	if err := json.Unmarshal(body, &responsePayload); err != nil {
-		return nil, err
+// url returns the full URL of an API path.
+func (p OpenAIProvider) url(path string) string {
+	if p.BaseURL == "" {
+		return defaultBaseURL + path
 	}
-
-	// Convert the embedding data to the expected return type
-	embeddings := make([][]float64, len(responsePayload.Data))
-	for i, emb := range responsePayload.Data {
-		embeddings[i] = emb.Embedding
-	}
-
-	return embeddings, nil
+	return strings.TrimRight(p.BaseURL, "/") + path
 }
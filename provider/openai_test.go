@@ -0,0 +1,217 @@
+package provider_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+	"github.com/yonidavidson/gopherconil.talk/provider"
+)
+
+func TestChatCompletionPayload(t *testing.T) {
+	tests := []struct {
+		name       string
+		model      string
+		wantRole   string
+		wantFields []string
+		rejected   []string
+	}{
+		{
+			name:       "chat model",
+			model:      "",
+			wantRole:   "system",
+			wantFields: []string{"max_tokens", "temperature", "top_p"},
+			rejected:   []string{"max_completion_tokens", "reasoning_effort"},
+		},
+		{
+			name:       "reasoning model snapshot",
+			model:      "o3-mini-2025-01-31",
+			wantRole:   "developer",
+			wantFields: []string{"max_completion_tokens", "reasoning_effort"},
+			rejected:   []string{"max_tokens", "temperature", "top_p"},
+		},
+		{
+			name:       "chat model sharing a reasoning family prefix",
+			model:      "gpt-5-chat-latest",
+			wantRole:   "system",
+			wantFields: []string{"max_tokens", "temperature", "top_p"},
+			rejected:   []string{"max_completion_tokens", "reasoning_effort"},
+		},
+		{
+			name:       "reasoning model without system messages",
+			model:      "o1-mini",
+			wantRole:   "user",
+			wantFields: []string{"max_completion_tokens"},
+			rejected:   []string{"max_tokens", "temperature", "top_p", "reasoning_effort"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var payload map[string]any
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+					t.Errorf("invalid request: %v", err)
+				}
+				fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"ok"}}],"usage":{"prompt_tokens":10,"completion_tokens":30,"total_tokens":40,"completion_tokens_details":{"reasoning_tokens":20}}}`)
+			}))
+			defer srv.Close()
+
+			p := provider.OpenAIProvider{APIKey: "test-key", BaseURL: srv.URL, Model: tt.model, ReasoningEffort: "low"}
+			c, u, err := p.ChatCompletionWithUsage([]prompt.Message{
+				{Role: prompt.RoleSystem, Content: "be brief"},
+				{Role: prompt.RoleUser, Content: "hi"},
+			})
+			if err != nil {
+				t.Fatalf("ChatCompletionWithUsage() error = %v", err)
+			}
+			if string(c) != "ok" {
+				t.Errorf("ChatCompletionWithUsage() = %q, want %q", c, "ok")
+			}
+			if u != (provider.Usage{PromptTokens: 10, CompletionTokens: 30, ReasoningTokens: 20, TotalTokens: 40}) {
+				t.Errorf("unexpected usage %+v", u)
+			}
+			role := payload["messages"].([]any)[0].(map[string]any)["role"]
+			if role != tt.wantRole {
+				t.Errorf("system message sent as %v, want %s", role, tt.wantRole)
+			}
+			for _, f := range tt.wantFields {
+				if _, ok := payload[f]; !ok {
+					t.Errorf("payload is missing %s: %v", f, payload)
+				}
+			}
+			for _, f := range tt.rejected {
+				if _, ok := payload[f]; ok {
+					t.Errorf("payload must not contain %s: %v", f, payload)
+				}
+			}
+		})
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	tests := []struct {
+		model     string
+		window    int
+		reasoning bool
+		effort    bool
+		role      prompt.Role
+	}{
+		{model: "gpt-4o-mini-2024-07-18", window: 128000, role: prompt.RoleSystem},
+		{model: "gpt-3.5-turbo-0125", window: 16385, role: prompt.RoleSystem},
+		{model: "gpt-4-turbo-preview", window: 128000, role: prompt.RoleSystem},
+		{model: "gpt-4", window: 8192, role: prompt.RoleSystem},
+		{model: "gpt-4-0613", window: 8192, role: prompt.RoleSystem},
+		{model: "gpt-4-1106-preview", window: 128000, role: prompt.RoleSystem},
+		{model: "gpt-5-2025-08-07", window: 400000, reasoning: true, effort: true, role: prompt.RoleDeveloper},
+		{model: "gpt-5-chat-latest", window: 128000, role: prompt.RoleSystem},
+		{model: "o1-mini", window: 128000, reasoning: true, role: prompt.RoleUser},
+		{model: "o1-mini-2024-09-12", window: 128000, reasoning: true, role: prompt.RoleUser},
+		{model: "o1-2024-12-17", window: 200000, reasoning: true, effort: true, role: prompt.RoleDeveloper},
+		{model: "unknown-model", window: 128000, role: prompt.RoleSystem},
+	}
+	for _, tt := range tests {
+		c := provider.Capabilities(tt.model)
+		if c.ContextWindow != tt.window || c.Reasoning != tt.reasoning || c.ReasoningEffort != tt.effort || c.SystemRole != tt.role {
+			t.Errorf("unexpected capabilities for %s: %+v", tt.model, c)
+		}
+	}
+}
+
+func TestChatCompletionMessageFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		model string
+		role  string
+	}{
+		{name: "chat model", model: "gpt-4o", role: "system"},
+		{name: "reasoning model", model: "o3-mini", role: "developer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var payload struct {
+				Messages []map[string]any `json:"messages"`
+			}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+					t.Errorf("invalid request: %v", err)
+				}
+				fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`)
+			}))
+			defer srv.Close()
+
+			p := provider.OpenAIProvider{APIKey: "test-key", BaseURL: srv.URL, Model: tt.model}
+			_, err := p.ChatCompletion([]prompt.Message{
+				{Role: prompt.RoleDeveloper, Content: "use tools"},
+				{Role: prompt.RoleUser, Content: "hi", Name: "alice"},
+				{Role: prompt.RoleAssistant, ToolCalls: []prompt.ToolCall{{ID: "call_1", Name: "answer", Arguments: `{"q":"hi"}`}}},
+				{Role: prompt.RoleTool, Content: "42", ToolCallID: "call_1"},
+			})
+			if err != nil {
+				t.Fatalf("ChatCompletion() error = %v", err)
+			}
+			want := []map[string]any{
+				{"role": tt.role, "content": "use tools"},
+				{"role": "user", "content": "hi", "name": "alice"},
+				{"role": "assistant", "content": "", "tool_calls": []any{
+					map[string]any{"id": "call_1", "type": "function", "function": map[string]any{"name": "answer", "arguments": `{"q":"hi"}`}},
+				}},
+				{"role": "tool", "content": "42", "tool_call_id": "call_1"},
+			}
+			if !reflect.DeepEqual(payload.Messages, want) {
+				t.Errorf("messages = %v, want %v", payload.Messages, want)
+			}
+		})
+	}
+}
+
+func TestChatCompletionInvalidMessages(t *testing.T) {
+	call := prompt.Message{Role: prompt.RoleAssistant, ToolCalls: []prompt.ToolCall{{ID: "call_1", Name: "answer", Arguments: "{}"}}}
+	tests := []struct {
+		name     string
+		messages []prompt.Message
+		wantErr  string
+	}{
+		{
+			name:     "tool message without a call",
+			messages: []prompt.Message{{Role: prompt.RoleUser, Content: "hi"}, {Role: prompt.RoleTool, Content: "42", ToolCallID: "call_1"}},
+			wantErr:  "isn't a tool call",
+		},
+		{
+			name:     "tool message answering another call",
+			messages: []prompt.Message{call, {Role: prompt.RoleTool, Content: "42", ToolCallID: "call_2"}},
+			wantErr:  "isn't a tool call",
+		},
+		{
+			name:     "tool message after another message",
+			messages: []prompt.Message{call, {Role: prompt.RoleUser, Content: "hi"}, {Role: prompt.RoleTool, Content: "42", ToolCallID: "call_1"}},
+			wantErr:  "isn't a tool call",
+		},
+		{
+			name:     "call answered twice",
+			messages: []prompt.Message{call, {Role: prompt.RoleTool, Content: "42", ToolCallID: "call_1"}, {Role: prompt.RoleTool, Content: "43", ToolCallID: "call_1"}},
+			wantErr:  "isn't a tool call",
+		},
+		{
+			name:     "invalid name",
+			messages: []prompt.Message{{Role: prompt.RoleUser, Content: "hi", Name: "alice smith"}},
+			wantErr:  "invalid name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Error("unexpected request for invalid messages")
+			}))
+			defer srv.Close()
+			p := provider.OpenAIProvider{APIKey: "test-key", BaseURL: srv.URL}
+			if _, err := p.ChatCompletion(tt.messages); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ChatCompletion() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
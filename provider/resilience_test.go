@@ -0,0 +1,177 @@
+package provider_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+	"github.com/yonidavidson/gopherconil.talk/provider"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := provider.NewCircuitBreaker(provider.BreakerConfig{Window: 4, MinRequests: 4, FailureRate: 0.5, OpenTimeout: 20 * time.Millisecond})
+	for _, ok := range []bool{true, false, true, false} {
+		g, err := b.Allow()
+		if err != nil {
+			t.Fatalf("Allow() error = %v while closed", err)
+		}
+		b.Record(g, ok)
+	}
+	if b.State() != provider.BreakerOpen {
+		t.Fatalf("expected the breaker to open, got %s", b.State())
+	}
+	if _, err := b.Allow(); !errors.Is(err, provider.ErrCircuitOpen) {
+		t.Fatalf("Allow() = %v, want ErrCircuitOpen", err)
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	if b.State() != provider.BreakerHalfOpen {
+		t.Fatalf("expected the breaker to be half-open, got %s", b.State())
+	}
+	g, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow() error = %v for the first probe", err)
+	}
+	if _, err := b.Allow(); !errors.Is(err, provider.ErrCircuitOpen) {
+		t.Fatalf("Allow() = %v for a second concurrent probe, want ErrCircuitOpen", err)
+	}
+	b.Record(g, false)
+	if b.State() != provider.BreakerOpen {
+		t.Fatalf("expected a failed probe to reopen the breaker, got %s", b.State())
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	g, err = b.Allow()
+	if err != nil {
+		t.Fatalf("Allow() error = %v for the second probe", err)
+	}
+	b.Record(g, true)
+	if b.State() != provider.BreakerClosed {
+		t.Fatalf("expected a successful probe to close the breaker, got %s", b.State())
+	}
+}
+
+func TestCircuitBreakerStaleOutcomes(t *testing.T) {
+	b := provider.NewCircuitBreaker(provider.BreakerConfig{Window: 2, MinRequests: 2, OpenTimeout: 20 * time.Millisecond})
+	// a slow call is allowed while closed and only finishes after the breaker moved on
+	slow, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow() error = %v while closed", err)
+	}
+	for i := 0; i < 2; i++ {
+		g, err := b.Allow()
+		if err != nil {
+			t.Fatalf("Allow() error = %v while closed", err)
+		}
+		b.Record(g, false)
+	}
+	if b.State() != provider.BreakerOpen {
+		t.Fatalf("expected the breaker to open, got %s", b.State())
+	}
+	b.Record(slow, true)
+	if b.State() != provider.BreakerOpen {
+		t.Fatalf("expected a stale success to leave the breaker open, got %s", b.State())
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	probe, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow() error = %v for the probe", err)
+	}
+	b.Record(slow, true)
+	b.Record(slow, false)
+	if b.State() != provider.BreakerHalfOpen {
+		t.Fatalf("expected stale outcomes to leave the probe running, got %s", b.State())
+	}
+	if _, err := b.Allow(); !errors.Is(err, provider.ErrCircuitOpen) {
+		t.Fatalf("Allow() = %v while the probe runs, want ErrCircuitOpen", err)
+	}
+	b.Record(probe, true)
+	if b.State() != provider.BreakerClosed {
+		t.Fatalf("expected the probe to close the breaker, got %s", b.State())
+	}
+}
+
+func TestWithCircuitBreaker(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	t.Setenv("PRIVATE_OPENAI_KEY", "test-key")
+	p, err := provider.NewOpenAIProvider(provider.WithCircuitBreaker(provider.BreakerConfig{Window: 2, MinRequests: 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.BaseURL = srv.URL
+
+	m := []prompt.Message{{Role: prompt.RoleUser, Content: "hi"}}
+	for i := 0; i < 2; i++ {
+		var se *provider.StatusError
+		if _, err := p.ChatCompletion(m); !errors.As(err, &se) || se.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("ChatCompletion() error = %v, want a 503 StatusError", err)
+		}
+	}
+	if _, err := p.ChatCompletion(m); !errors.Is(err, provider.ErrCircuitOpen) {
+		t.Fatalf("ChatCompletion() error = %v, want ErrCircuitOpen", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("expected the open breaker to stop calls, server got %d", calls.Load())
+	}
+	if p.Breaker("/embeddings").State() != provider.BreakerClosed {
+		t.Errorf("expected the embeddings breaker to be independent")
+	}
+}
+
+func TestWithHedging(t *testing.T) {
+	var calls, cancelled atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		// consume the body so the server notices when the client goes away
+		_, _ = io.Copy(io.Discard, r.Body)
+		if n == 2 {
+			// the first attempt of the second completion hangs until it is cancelled
+			select {
+			case <-r.Context().Done():
+				cancelled.Add(1)
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+		fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","content":"answer %d"}}]}`, n)
+	}))
+	defer srv.Close()
+	t.Setenv("PRIVATE_OPENAI_KEY", "test-key")
+	p, err := provider.NewOpenAIProvider(provider.WithHedging(provider.HedgeConfig{MinSamples: 1, MinDelay: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.BaseURL = srv.URL
+
+	m := []prompt.Message{{Role: prompt.RoleUser, Content: "hi"}}
+	if _, err := p.ChatCompletion(m); err != nil {
+		t.Fatalf("ChatCompletion() error = %v", err)
+	}
+	start := time.Now()
+	c, err := p.ChatCompletion(m)
+	if err != nil {
+		t.Fatalf("ChatCompletion() error = %v", err)
+	}
+	if string(c) != "answer 3" {
+		t.Errorf("ChatCompletion() = %q, want the hedged answer", c)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("hedged request took %s", took)
+	}
+	srv.Close()
+	if cancelled.Load() != 1 {
+		t.Errorf("expected the slow attempt to be cancelled")
+	}
+}
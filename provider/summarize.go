@@ -0,0 +1,31 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+)
+
+// summarizePrompt asks the model to condense a transcript, the transcript is escaped by the template.
+const summarizePrompt = `<system>You summarize conversations between a user and an assistant.
+Keep the facts, names, preferences, decisions and open questions the assistant needs to carry on the conversation.
+Answer with the summary only, in a few sentences.</system>
+<user>{{.Transcript}}</user>`
+
+// Summarize condenses messages into a short text, it makes OpenAIProvider a prompt.Summarizer.
+func (p OpenAIProvider) Summarize(messages []prompt.Message) (string, error) {
+	var transcript strings.Builder
+	if err := prompt.EncodeTagged(&transcript, messages); err != nil {
+		return "", err
+	}
+	m, _, err := prompt.ParseMessages(summarizePrompt, map[string]string{"Transcript": transcript.String()})
+	if err != nil {
+		return "", fmt.Errorf("error building summary prompt: %v", err)
+	}
+	c, err := p.ChatCompletion(m)
+	if err != nil {
+		return "", fmt.Errorf("error summarizing messages: %v", err)
+	}
+	return string(c), nil
+}
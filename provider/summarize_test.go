@@ -0,0 +1,45 @@
+package provider_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+	"github.com/yonidavidson/gopherconil.talk/provider"
+)
+
+func TestSummarize(t *testing.T) {
+	var req struct {
+		Messages []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request: %v", err)
+		}
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"The user plans a trip to France."}}]}`)
+	}))
+	defer srv.Close()
+
+	var s prompt.Summarizer = provider.OpenAIProvider{APIKey: "test-key", BaseURL: srv.URL}
+	got, err := s.Summarize([]prompt.Message{
+		{Role: prompt.RoleUser, Content: "I am thinking about visiting France."},
+		{Role: prompt.RoleAssistant, Content: "Great choice!"},
+	})
+	if err != nil {
+		t.Fatalf("Summarize() error = %v", err)
+	}
+	if got != "The user plans a trip to France." {
+		t.Errorf("Summarize() = %q", got)
+	}
+	if len(req.Messages) != 2 || req.Messages[1].Role != "user" ||
+		!strings.Contains(req.Messages[1].Content, "<user>\nI am thinking about visiting France.\n</user>") {
+		t.Errorf("unexpected request %+v", req.Messages)
+	}
+}
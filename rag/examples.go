@@ -0,0 +1,130 @@
+package rag
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+	"github.com/yonidavidson/gopherconil.talk/tokenizer"
+)
+
+type (
+	// Example is a few-shot example, an input and the output we want the model to give for it
+	Example struct {
+		Input  string
+		Output string
+	}
+
+	// Examples are the examples picked for a query, templates render them with {{.Examples.Turns}}
+	Examples []Example
+
+	// ExampleSelector stores examples with the embeddings of their inputs and picks the ones relevant to a query
+	ExampleSelector struct {
+		r        *Rag
+		examples []Example
+		vectors  [][]float64
+		// Lambda trades relevance for diversity when picking examples, 1 ignores diversity
+		Lambda float64
+	}
+)
+
+// DefaultLambda favors relevance while avoiding near duplicate examples.
+const DefaultLambda = 0.7
+
+// exampleOverhead approximates the tokens the chat format adds to the two messages of an example.
+const exampleOverhead = 8
+
+// NewExampleSelector embeds the inputs of the examples.
+func (r *Rag) NewExampleSelector(examples ...Example) (*ExampleSelector, error) {
+	s := &ExampleSelector{r: r, Lambda: DefaultLambda}
+	if err := s.Add(examples...); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Add embeds more examples.
+func (s *ExampleSelector) Add(examples ...Example) error {
+	if len(examples) == 0 {
+		return nil
+	}
+	inputs := make([]string, len(examples))
+	for i, e := range examples {
+		inputs[i] = e.Input
+	}
+	vectors, err := s.r.provider.TextEmbedding(inputs)
+	if err != nil {
+		return fmt.Errorf("error embedding examples: %v", err)
+	}
+	s.examples = append(s.examples, examples...)
+	s.vectors = append(s.vectors, vectors...)
+	return nil
+}
+
+// Select picks up to k examples for the query whose turns fit in maxTokens, using maximal marginal relevance:
+// each pick is the example most similar to the query and least similar to the examples already picked.
+// The examples are returned in the order they were picked, the most relevant first.
+func (s *ExampleSelector) Select(query string, k, maxTokens int) (Examples, error) {
+	if k <= 0 || len(s.examples) == 0 {
+		return nil, nil
+	}
+	q, err := s.r.provider.TextEmbedding([]string{query})
+	if err != nil {
+		return nil, fmt.Errorf("error embedding query: %v", err)
+	}
+	enc := tokenizer.Default()
+	relevance := make([]float64, len(s.examples))
+	for i, v := range s.vectors {
+		relevance[i] = cosineSimilarity(q[0], v)
+	}
+	var picked []int
+	used := make([]bool, len(s.examples))
+	budget := maxTokens
+	for len(picked) < k {
+		best, bestScore := -1, math.Inf(-1)
+		for i := range s.examples {
+			if used[i] {
+				continue
+			}
+			redundancy := 0.0
+			for _, j := range picked {
+				redundancy = math.Max(redundancy, cosineSimilarity(s.vectors[i], s.vectors[j]))
+			}
+			if score := s.Lambda*relevance[i] - (1-s.Lambda)*redundancy; score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best < 0 {
+			break
+		}
+		used[best] = true
+		// an example too long for what is left of the budget is skipped, a shorter one may still fit
+		e := s.examples[best]
+		if cost := enc.Count(e.Input) + enc.Count(e.Output) + exampleOverhead; cost <= budget {
+			budget -= cost
+			picked = append(picked, best)
+		}
+	}
+	result := make(Examples, len(picked))
+	for i, j := range picked {
+		result[i] = s.examples[j]
+	}
+	return result, nil
+}
+
+// Messages returns the examples as user and assistant turns.
+func (e Examples) Messages() []prompt.Message {
+	messages := make([]prompt.Message, 0, 2*len(e))
+	for _, ex := range e {
+		messages = append(messages,
+			prompt.Message{Role: prompt.RoleUser, Content: ex.Input},
+			prompt.Message{Role: prompt.RoleAssistant, Content: ex.Output},
+		)
+	}
+	return messages
+}
+
+// Turns renders the examples as tagged user and assistant messages for a template.
+func (e Examples) Turns() (prompt.Raw, error) {
+	return prompt.Tagged(e.Messages())
+}
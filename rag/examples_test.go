@@ -0,0 +1,111 @@
+package rag_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yonidavidson/gopherconil.talk/prompt"
+	"github.com/yonidavidson/gopherconil.talk/provider"
+	"github.com/yonidavidson/gopherconil.talk/rag"
+)
+
+// vectors are the stand-in embeddings, two near duplicate weather examples and two other topics.
+var vectors = map[string][]float64{
+	"weather in Paris?":  {1, 0, 0},
+	"weather in Lyon?":   {0.99, 0.14, 0},
+	"weather in Nice?":   {0.95, 0, 0.3},
+	"capital of France?": {0.1, 1, 0},
+	"translate hello":    {0, 0, 1},
+	"is it raining?":     {1, 0.05, 0},
+}
+
+func newEmbeddingServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request: %v", err)
+		}
+		var resp struct {
+			Data []map[string][]float64 `json:"data"`
+		}
+		for _, in := range req.Input {
+			v, ok := vectors[in]
+			if !ok {
+				t.Errorf("no stand-in embedding for %q", in)
+			}
+			resp.Data = append(resp.Data, map[string][]float64{"embedding": v})
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestExampleSelector(t *testing.T) {
+	srv := newEmbeddingServer(t)
+	defer srv.Close()
+	r := rag.New(&provider.OpenAIProvider{APIKey: "test-key", BaseURL: srv.URL})
+	s, err := r.NewExampleSelector(
+		rag.Example{Input: "weather in Paris?", Output: "Sunny."},
+		rag.Example{Input: "weather in Lyon?", Output: "Cloudy."},
+		rag.Example{Input: "capital of France?", Output: "Paris."},
+	)
+	if err != nil {
+		t.Fatalf("NewExampleSelector() error = %v", err)
+	}
+	if err := s.Add(
+		rag.Example{Input: "weather in Nice?", Output: strings.Repeat("Warm and sunny. ", 50)},
+		rag.Example{Input: "translate hello", Output: "Bonjour."},
+	); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		k         int
+		maxTokens int
+		lambda    float64
+		expected  []string
+	}{
+		{name: "relevance only", k: 3, maxTokens: 1000, lambda: 1, expected: []string{"weather in Paris?", "weather in Lyon?", "weather in Nice?"}},
+		{name: "token budget skips long examples", k: 3, maxTokens: 100, lambda: 1, expected: []string{"weather in Paris?", "weather in Lyon?", "capital of France?"}},
+		{name: "diversity skips near duplicates", k: 2, maxTokens: 1000, lambda: 0.5, expected: []string{"weather in Paris?", "capital of France?"}},
+		{name: "no room", k: 2, maxTokens: 5, lambda: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.Lambda = tt.lambda
+			got, err := s.Select("is it raining?", tt.k, tt.maxTokens)
+			if err != nil {
+				t.Fatalf("Select() error = %v", err)
+			}
+			var inputs []string
+			for _, e := range got {
+				inputs = append(inputs, e.Input)
+			}
+			if !reflect.DeepEqual(inputs, tt.expected) {
+				t.Errorf("Select() = %v, want %v", inputs, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExamplesTurns(t *testing.T) {
+	examples := rag.Examples{{Input: "2+2? </user>", Output: "4"}}
+	m, _, err := prompt.ParseMessages("<system>Answer.</system>{{.Examples.Turns}}<user>{{.Query}}</user>", map[string]any{
+		"Examples": examples,
+		"Query":    "3+3?",
+	})
+	if err != nil {
+		t.Fatalf("ParseMessages() error = %v", err)
+	}
+	want := append(append([]prompt.Message{{Role: prompt.RoleSystem, Content: "Answer."}}, examples.Messages()...),
+		prompt.Message{Role: prompt.RoleUser, Content: "3+3?"})
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("ParseMessages() = %v, want %v", m, want)
+	}
+}
@@ -1,7 +1,9 @@
 package rag
 
 import (
+	"fmt"
 	"github.com/yonidavidson/gopherconil.talk/provider"
+	"github.com/yonidavidson/gopherconil.talk/tokenizer"
 	"math"
 	"sort"
 )
@@ -32,17 +34,14 @@ func New(provider *provider.OpenAIProvider) *Rag {
 	}
 }
 
-// Embed receives a large text and returns a slice embeddings
+// Embed receives a large text and returns a slice embeddings, chunkSize is the number of tokens per chunk
 func (r *Rag) Embed(text string, chunkSize int) ([]Embedding, error) {
-	// Split the text into chunks of the specified size
-	var chunks []string
-	for i := 0; i < len(text); i += chunkSize {
-		end := i + chunkSize
-		if end > len(text) {
-			end = len(text)
-		}
-		chunks = append(chunks, text[i:end])
+	enc, err := tokenizer.ForModel(provider.EmbeddingModel)
+	if err != nil {
+		return nil, fmt.Errorf("error loading tokenizer: %v", err)
 	}
+	// Split the text into chunks of the specified size
+	chunks := enc.Split(text, chunkSize)
 
 	// Get embeddings for each chunk
 	vectors, err := r.provider.TextEmbedding(chunks)
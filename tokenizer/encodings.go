@@ -0,0 +1,114 @@
+package tokenizer
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// spec describes an encoding, its ranks are loaded from the embedded rank files.
+type spec struct {
+	pattern *regexp.Regexp
+	special map[string]int
+}
+
+const (
+	Cl100kBase = "cl100k_base"
+	O200kBase  = "o200k_base"
+)
+
+// space is the Unicode White_Space class, Go's \s only covers ASCII.
+const space = `\s\x0B\x{85}\p{Z}`
+
+var (
+	//go:embed ranks
+	rankFiles embed.FS
+
+	specs = map[string]spec{
+		Cl100kBase: {
+			pattern: regexp.MustCompile(strings.Join([]string{
+				`(?i:'s|'t|'re|'ve|'m|'ll|'d)`,
+				`[^\r\n\p{L}\p{N}]?\p{L}+`,
+				`\p{N}{1,3}`,
+				` ?[^` + space + `\p{L}\p{N}]+[\r\n]*`,
+				`[` + space + `]*[\r\n]+`,
+				`[` + space + `]+`,
+			}, "|")),
+			special: map[string]int{
+				"<|endoftext|>":   100257,
+				"<|fim_prefix|>":  100258,
+				"<|fim_middle|>":  100259,
+				"<|fim_suffix|>":  100260,
+				"<|endofprompt|>": 100276,
+			},
+		},
+		O200kBase: {
+			pattern: regexp.MustCompile(strings.Join([]string{
+				`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?`,
+				`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?`,
+				`\p{N}{1,3}`,
+				` ?[^` + space + `\p{L}\p{N}]+[\r\n/]*`,
+				`[` + space + `]*[\r\n]+`,
+				`[` + space + `]+`,
+			}, "|")),
+			special: map[string]int{
+				"<|endoftext|>":   199999,
+				"<|endofprompt|>": 200018,
+			},
+		},
+	}
+
+	mu     sync.Mutex
+	loaded = map[string]*Encoding{}
+)
+
+// Get returns an encoding by name, its rank file is loaded on first use.
+func Get(name string) (*Encoding, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if e, ok := loaded[name]; ok {
+		return e, nil
+	}
+	if _, ok := specs[name]; !ok {
+		return nil, fmt.Errorf("unknown encoding %q", name)
+	}
+	f, err := rankFiles.Open("ranks/" + name + ".tiktoken")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("encoding %s has no rank file ranks/%s.tiktoken", name, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	e, err := Load(name, f)
+	if err != nil {
+		return nil, err
+	}
+	loaded[name] = e
+	return e, nil
+}
+
+// ForModel returns the encoding used by a model, models using older encodings are not supported.
+func ForModel(model string) (*Encoding, error) {
+	switch {
+	case strings.HasPrefix(model, "gpt-4o"), strings.HasPrefix(model, "gpt-4.1"), strings.HasPrefix(model, "gpt-4.5"),
+		strings.HasPrefix(model, "gpt-5"), strings.HasPrefix(model, "o1"), strings.HasPrefix(model, "o3"), strings.HasPrefix(model, "o4"):
+		return Get(O200kBase)
+	case strings.HasPrefix(model, "gpt-4"), strings.HasPrefix(model, "gpt-3.5"), strings.HasPrefix(model, "text-embedding-"):
+		return Get(Cl100kBase)
+	}
+	return nil, fmt.Errorf("no known encoding for model %q", model)
+}
+
+// Default returns o200k_base, the encoding of the default chat model.
+func Default() *Encoding {
+	e, err := Get(O200kBase)
+	if err != nil {
+		panic(fmt.Sprintf("tokenizer: loading %s: %v", O200kBase, err))
+	}
+	return e
+}
@@ -0,0 +1,274 @@
+// Package tokenizer implements the byte pair encodings used by OpenAI models.
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Encoding is a byte pair encoding such as cl100k_base or o200k_base.
+type Encoding struct {
+	name    string
+	ranks   map[string]int
+	decoder map[int]string
+	special map[int]string
+	pattern *regexp.Regexp
+}
+
+// Load reads a tiktoken rank file for one of the supported encodings, this is useful to use rank files from disk.
+func Load(name string, r io.Reader) (*Encoding, error) {
+	s, ok := specs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding %q", name)
+	}
+	ranks := make(map[string]int)
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a token and a rank", name, line)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid token: %v", name, line, err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid rank: %v", name, line, err)
+		}
+		ranks[string(token)] = rank
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	for b := 0; b < 256; b++ {
+		if _, ok := ranks[string([]byte{byte(b)})]; !ok {
+			return nil, fmt.Errorf("%s: rank file is missing the single byte token %#x", name, b)
+		}
+	}
+	return newEncoding(name, s, ranks), nil
+}
+
+func newEncoding(name string, s spec, ranks map[string]int) *Encoding {
+	e := &Encoding{
+		name:    name,
+		ranks:   ranks,
+		decoder: make(map[int]string, len(ranks)),
+		special: make(map[int]string, len(s.special)),
+		pattern: s.pattern,
+	}
+	for token, rank := range ranks {
+		e.decoder[rank] = token
+	}
+	for token, rank := range s.special {
+		e.special[rank] = token
+	}
+	return e
+}
+
+// Name returns the name of the encoding.
+func (e *Encoding) Name() string {
+	return e.name
+}
+
+// Encode returns the tokens of text, special tokens such as <|endoftext|> are encoded as plain text.
+func (e *Encoding) Encode(text string) []int {
+	tokens, _ := e.encode(text)
+	return tokens
+}
+
+// Decode returns the text of tokens, it may not be valid UTF-8 when tokens split a character.
+func (e *Encoding) Decode(tokens []int) string {
+	var sb strings.Builder
+	for _, t := range tokens {
+		if s, ok := e.decoder[t]; ok {
+			sb.WriteString(s)
+		} else if s, ok := e.special[t]; ok {
+			sb.WriteString(s)
+		}
+	}
+	return sb.String()
+}
+
+// Count returns the number of tokens in text.
+func (e *Encoding) Count(text string) int {
+	var n int
+	for _, piece := range e.pieces(text) {
+		if _, ok := e.ranks[piece]; ok {
+			n++
+			continue
+		}
+		n += len(e.merge(piece))
+	}
+	return n
+}
+
+// Truncate returns the longest prefix of text that has at most n tokens and doesn't cut through a character.
+func (e *Encoding) Truncate(text string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	tokens, ends := e.encode(text)
+	if len(tokens) <= n {
+		return text
+	}
+	for k := n; k > 0; k-- {
+		cut := ends[k-1]
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		if prefix := text[:cut]; e.Count(prefix) <= n {
+			return prefix
+		}
+	}
+	return ""
+}
+
+// TruncateStart returns the longest suffix of text that has at most n tokens and doesn't cut through a character.
+func (e *Encoding) TruncateStart(text string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	tokens, ends := e.encode(text)
+	if len(tokens) <= n {
+		return text
+	}
+	for k := n; k > 0; k-- {
+		cut := ends[len(tokens)-k-1]
+		for cut < len(text) && !utf8.RuneStart(text[cut]) {
+			cut++
+		}
+		if suffix := text[cut:]; e.Count(suffix) <= n {
+			return suffix
+		}
+	}
+	return ""
+}
+
+// Split cuts text into consecutive chunks of at most n tokens, chunks never cut through a character.
+func (e *Encoding) Split(text string, n int) []string {
+	if n <= 0 || text == "" {
+		return nil
+	}
+	_, ends := e.encode(text)
+	var chunks []string
+	start, first := 0, 0
+	for first < len(ends) {
+		last := first + n - 1
+		if last >= len(ends) {
+			last = len(ends) - 1
+		}
+		cut := ends[last]
+		for cut < len(text) && cut > start && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		if cut == start {
+			// a single character is longer than n tokens, keep it whole
+			cut = ends[last]
+			for cut < len(text) && !utf8.RuneStart(text[cut]) {
+				cut++
+			}
+		}
+		chunks = append(chunks, text[start:cut])
+		start = cut
+		for first < len(ends) && ends[first] <= cut {
+			first++
+		}
+	}
+	return chunks
+}
+
+// encode returns the tokens of text and the byte offset where each token ends.
+func (e *Encoding) encode(text string) ([]int, []int) {
+	var tokens, ends []int
+	offset := 0
+	for _, piece := range e.pieces(text) {
+		if rank, ok := e.ranks[piece]; ok {
+			tokens = append(tokens, rank)
+			offset += len(piece)
+			ends = append(ends, offset)
+			continue
+		}
+		for _, part := range e.merge(piece) {
+			tokens = append(tokens, e.ranks[part])
+			offset += len(part)
+			ends = append(ends, offset)
+		}
+	}
+	return tokens, ends
+}
+
+// merge applies byte pair merges to a piece, lowest rank first, and returns the resulting parts.
+func (e *Encoding) merge(piece string) []string {
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i+2 < len(bounds); i++ {
+			if rank, ok := e.ranks[piece[bounds[i]:bounds[i+2]]]; ok && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+	}
+	parts := make([]string, len(bounds)-1)
+	for i := range parts {
+		parts[i] = piece[bounds[i]:bounds[i+1]]
+	}
+	return parts
+}
+
+// pieces splits text with the encoding pattern before merging.
+// Go regexp has no lookahead, so the `\s+(?!\S)` rule of the original pattern is applied here:
+// a whitespace run followed by a non whitespace character leaves its last character to the next piece.
+func (e *Encoding) pieces(text string) []string {
+	var pieces []string
+	for start := 0; start < len(text); {
+		loc := e.pattern.FindStringIndex(text[start:])
+		if loc == nil || loc[1] == 0 {
+			// invalid UTF-8 is matched by nothing, keep it as a piece of its own
+			_, size := utf8.DecodeRuneInString(text[start:])
+			pieces = append(pieces, text[start:start+size])
+			start += size
+			continue
+		}
+		end := start + loc[1]
+		if loc[0] > 0 {
+			pieces = append(pieces, text[start:start+loc[0]])
+		}
+		match := text[start+loc[0] : end]
+		if end < len(text) && isSpace(match) && !strings.HasSuffix(match, "\n") && !strings.HasSuffix(match, "\r") {
+			if _, size := utf8.DecodeLastRuneInString(match); size < len(match) {
+				end -= size
+			}
+		}
+		pieces = append(pieces, text[start+loc[0]:end])
+		start = end
+	}
+	return pieces
+}
+
+func isSpace(s string) bool {
+	for _, r := range s {
+		if !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
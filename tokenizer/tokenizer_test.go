@@ -0,0 +1,165 @@
+package tokenizer_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/yonidavidson/gopherconil.talk/tokenizer"
+)
+
+// testEncoding builds a small cl100k_base style rank file: every byte plus a few merges.
+func testEncoding(t *testing.T, merges ...string) *tokenizer.Encoding {
+	t.Helper()
+	var sb strings.Builder
+	for b := 0; b < 256; b++ {
+		fmt.Fprintf(&sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(b)}), b)
+	}
+	for i, m := range merges {
+		fmt.Fprintf(&sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(m)), 256+i)
+	}
+	e, err := tokenizer.Load(tokenizer.Cl100kBase, strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	return e
+}
+
+func TestEncode(t *testing.T) {
+	e := testEncoding(t, "he", "ll", "hell", "hello", " w", " wo", "or", " wor", " worl", "ld", " world")
+	tests := []struct {
+		name  string
+		input string
+		want  []int
+	}{
+		{name: "merged words", input: "hello world", want: []int{259, 266}},
+		{name: "partial merges", input: "help", want: []int{256, 'l', 'p'}},
+		{name: "pieces never merge across words", input: "he llo", want: []int{256, ' ', 257, 'o'}},
+		{name: "empty", input: "", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := e.Encode(tt.input)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Encode(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+			if d := e.Decode(got); d != tt.input {
+				t.Errorf("Decode(Encode(%q)) = %q", tt.input, d)
+			}
+			if c := e.Count(tt.input); c != len(tt.want) {
+				t.Errorf("Count(%q) = %d, want %d", tt.input, c, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	e := testEncoding(t)
+	hebrew := "שלום עולם, מה שלומך?"
+	for n := 0; n <= e.Count(hebrew); n++ {
+		head := e.Truncate(hebrew, n)
+		tail := e.TruncateStart(hebrew, n)
+		for _, s := range []string{head, tail} {
+			if !utf8.ValidString(s) {
+				t.Fatalf("truncating to %d tokens cut through a character: %q", n, s)
+			}
+			if c := e.Count(s); c > n {
+				t.Fatalf("truncating to %d tokens returned %d tokens", n, c)
+			}
+		}
+		if !strings.HasPrefix(hebrew, head) || !strings.HasSuffix(hebrew, tail) {
+			t.Fatalf("unexpected truncation to %d tokens: %q, %q", n, head, tail)
+		}
+	}
+	if got := e.Truncate(hebrew, 1000); got != hebrew {
+		t.Errorf("Truncate() = %q, want the whole text", got)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	e := testEncoding(t)
+	text := "code: fmt.Println(\"שלום\")\n"
+	chunks := e.Split(text, 3)
+	if strings.Join(chunks, "") != text {
+		t.Fatalf("Split() lost content: %q", chunks)
+	}
+	for _, c := range chunks {
+		if !utf8.ValidString(c) {
+			t.Errorf("Split() cut through a character: %q", c)
+		}
+		if e.Count(c) > 3 {
+			t.Errorf("Split() chunk %q has more than 3 tokens", c)
+		}
+	}
+}
+
+func TestPretokenizer(t *testing.T) {
+	e := testEncoding(t, "  ", " x")
+	// with the lookahead rule the run of spaces leaves one space to the word that follows it
+	if got, want := e.Encode("   x"), []int{256, 257}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Encode() = %v, want %v", got, want)
+	}
+	// trailing whitespace is kept whole
+	if got, want := e.Encode("x  "), []int{'x', 256}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Encode() = %v, want %v", got, want)
+	}
+}
+
+func TestGet(t *testing.T) {
+	for _, name := range []string{tokenizer.Cl100kBase, tokenizer.O200kBase} {
+		e, err := tokenizer.Get(name)
+		if err != nil {
+			t.Fatalf("Get(%s) error = %v", name, err)
+		}
+		text := "Hello, שלום!"
+		if d := e.Decode(e.Encode(text)); d != text {
+			t.Errorf("%s round trip = %q, want %q", name, d, text)
+		}
+	}
+	if _, err := tokenizer.Get("p50k_base"); err == nil {
+		t.Error("expected an error for an unknown encoding")
+	}
+	if e, err := tokenizer.ForModel("gpt-4o-mini-2024-07-18"); err != nil || e.Name() != tokenizer.O200kBase {
+		t.Errorf("ForModel() = %v, %v", e, err)
+	}
+}
+
+// TestKnownVectors checks the encodings against tokens produced by tiktoken.
+func TestKnownVectors(t *testing.T) {
+	tests := []struct {
+		encoding string
+		input    string
+		want     []int
+	}{
+		{encoding: tokenizer.Cl100kBase, input: "hello world", want: []int{15339, 1917}},
+		{encoding: tokenizer.Cl100kBase, input: "Hello, world!", want: []int{9906, 11, 1917, 0}},
+		{encoding: tokenizer.Cl100kBase, input: "I'm here, they'll see", want: []int{40, 2846, 1618, 11, 814, 3358, 1518}},
+		{encoding: tokenizer.Cl100kBase, input: "1234567 apples", want: []int{4513, 10961, 22, 41776}},
+		{encoding: tokenizer.Cl100kBase, input: "line one\n\n  line two  ", want: []int{1074, 832, 271, 220, 1584, 1403, 256}},
+		{encoding: tokenizer.Cl100kBase, input: "שלום עולם 👋", want: []int{59511, 50391, 37769, 251, 17732, 95, 37769, 250, 147, 251, 62904, 233}},
+		{encoding: tokenizer.O200kBase, input: "hello world", want: []int{24912, 2375}},
+		{encoding: tokenizer.O200kBase, input: "Hello, world!", want: []int{13225, 11, 2375, 0}},
+		{encoding: tokenizer.O200kBase, input: "I'm here, they'll see", want: []int{15390, 2105, 11, 57956, 1921}},
+		{encoding: tokenizer.O200kBase, input: "1234567 apples", want: []int{7633, 19354, 22, 57814}},
+		{encoding: tokenizer.O200kBase, input: "line one\n\n  line two  ", want: []int{1137, 1001, 279, 220, 2543, 1920, 256}},
+		{encoding: tokenizer.O200kBase, input: "שלום עולם 👋", want: []int{106154, 143896, 61138, 233}},
+		{encoding: tokenizer.O200kBase, input: "HTTPServer parseJSON", want: []int{17893, 6444, 8420, 8259}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding+" "+tt.input, func(t *testing.T) {
+			e, err := tokenizer.Get(tt.encoding)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if got := e.Encode(tt.input); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Encode(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+			if c := e.Count(tt.input); c != len(tt.want) {
+				t.Errorf("Count(%q) = %d, want %d", tt.input, c, len(tt.want))
+			}
+		})
+	}
+}